@@ -9,6 +9,6 @@ Checks       :{{ range .Checks }}
   - Protocol : {{ .Protocol.String | purple }}
     Host     : {{ $a := splitList ":" .Address }}{{ index $a 0 | yellow }}{{ $l := len $a }}{{ if eq $l 2 }}
     Port     : {{ index $a 1 | yellow }}{{ end }}
-    {{ if .Result.IsError }}Result   : {{ .Result.String | red }}{{ else }}Result   : {{ .Result.String | green }}{{ end }}{{ end }}
+    {{ if .Result.IsError }}Result   : {{ .Result.String | red }}{{ else if .Result.IsWarning }}Result   : {{ .Result.String | yellow }}{{ else }}Result   : {{ .Result.String | green }}{{ end }}{{ end }}
 --------------------------------------------------------------------------------{{ end }}
 
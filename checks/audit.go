@@ -0,0 +1,288 @@
+package checks
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+)
+
+// DefaultSSHDeny lists the SSH algorithms denied by default in audits.
+var DefaultSSHDeny = []string{
+	"diffie-hellman-group1-sha1",
+	"diffie-hellman-group-exchange-sha1",
+	"ssh-dss",
+	"arcfour",
+	"3des-cbc",
+	"blowfish-cbc",
+	"hmac-md5",
+	"hmac-sha1-96",
+}
+
+// DefaultTLSDeny lists the TLS versions and cipher suites denied by default
+// in audits.
+var DefaultTLSDeny = []string{
+	"TLS 1.0",
+	"TLS 1.1",
+	"RC4",
+	"3DES",
+}
+
+// AuditPolicy enables the audit of the cryptography accepted by the server in
+// SSH, TLS and HTTPS checks; the check fails if the server accepts any of the
+// denied algorithms.
+type AuditPolicy struct {
+	// Deny lists the denied algorithms, cipher suites and TLS versions (e.g.
+	// "TLS 1.0"); an entry denies all the values containing it, regardless of
+	// case, so "RC4" denies all RC4 cipher suites and "cbc" all SSH ciphers in
+	// CBC mode. If empty, DefaultSSHDeny or DefaultTLSDeny apply.
+	Deny []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+	// Timeout is how long all the probes of a TLS audit may take together,
+	// so that a server dropping them does not hold the check for the timeout
+	// of each one; if zero, the check's timeout applies.
+	Timeout Timeout `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// AuditResult contains the cryptography accepted by the server.
+type AuditResult struct {
+	// KEX lists the key exchange algorithms offered by an SSH server.
+	KEX []string `json:"kex,omitempty" yaml:"kex,omitempty"`
+	// HostKeys lists the host key algorithms offered by an SSH server.
+	HostKeys []string `json:"host_keys,omitempty" yaml:"host_keys,omitempty"`
+	// Ciphers lists the ciphers offered by an SSH server.
+	Ciphers []string `json:"ciphers,omitempty" yaml:"ciphers,omitempty"`
+	// MACs lists the MAC algorithms offered by an SSH server.
+	MACs []string `json:"macs,omitempty" yaml:"macs,omitempty"`
+	// Versions lists the TLS versions accepted by a TLS server.
+	Versions []string `json:"versions,omitempty" yaml:"versions,omitempty"`
+	// CipherSuites lists the cipher suites accepted by a TLS server.
+	CipherSuites []string `json:"cipher_suites,omitempty" yaml:"cipher_suites,omitempty"`
+	// Violations lists the accepted values that are denied by the policy.
+	Violations []string `json:"violations,omitempty" yaml:"violations,omitempty"`
+	// Incomplete is whether the TLS audit ran out of time before probing all
+	// the versions and cipher suites.
+	Incomplete bool `json:"incomplete,omitempty" yaml:"incomplete,omitempty"`
+}
+
+// check records the values matching any of the denied entries as violations.
+func (r *AuditResult) check(deny []string, values ...[]string) {
+	for _, value := range slices.Concat(values...) {
+		for _, entry := range deny {
+			if strings.Contains(strings.ToLower(value), strings.ToLower(entry)) && !slices.Contains(r.Violations, value) {
+				r.Violations = append(r.Violations, value)
+			}
+		}
+	}
+}
+
+// auditSSH records the algorithms offered by the SSH server at the given
+// address and fails if any of them is denied; it does nothing unless the
+// check has an audit policy.
+func (c *Check) auditSSH(address string) error {
+	if c.Audit == nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", address, time.Duration(c.Timeout))
+	if err != nil {
+		slog.Error("error dialling", "address", address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error dialling %s for audit: %w", address, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(time.Duration(c.Timeout))); err != nil {
+		return fmt.Errorf("error setting deadline on connection to %s: %w", address, err)
+	}
+
+	lists, err := readKEXInit(conn)
+	if err != nil {
+		slog.Error("error reading SSH key exchange", "address", address, "error", err)
+		return fmt.Errorf("error reading key exchange from %s: %w", address, err)
+	}
+	result := &AuditResult{
+		KEX:      lists[0],
+		HostKeys: lists[1],
+		Ciphers:  lists[2],
+		MACs:     lists[4],
+	}
+	// the algorithms for the two directions are usually the same
+	for _, cipher := range lists[3] {
+		if !slices.Contains(result.Ciphers, cipher) {
+			result.Ciphers = append(result.Ciphers, cipher)
+		}
+	}
+	for _, mac := range lists[5] {
+		if !slices.Contains(result.MACs, mac) {
+			result.MACs = append(result.MACs, mac)
+		}
+	}
+	deny := c.Audit.Deny
+	if len(deny) == 0 {
+		deny = DefaultSSHDeny
+	}
+	result.check(deny, result.KEX, result.HostKeys, result.Ciphers, result.MACs)
+	c.Result.Audit = result
+	if len(result.Violations) > 0 {
+		slog.Error("server accepts denied algorithms", "address", address, "violations", result.Violations)
+		return withClass(ClassAssertionFailed, fmt.Errorf("host %s accepts denied algorithms: %s", address, strings.Join(result.Violations, ", ")))
+	}
+	return nil
+}
+
+// readKEXInit exchanges the version strings with an SSH server and returns
+// the name-lists in its SSH_MSG_KEXINIT message (RFC 4253, section 7.1): key
+// exchange, host key, ciphers and MACs in both directions, and so on.
+func readKEXInit(conn net.Conn) ([][]string, error) {
+	if _, err := io.WriteString(conn, "SSH-2.0-netcheck\r\n"); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	for {
+		// the server may send other lines before its version
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, "SSH-") {
+			break
+		}
+	}
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length < 2 || length > 35000 || int(header[4]) >= int(length) {
+		return nil, errors.New("malformed SSH packet")
+	}
+	packet := make([]byte, length-1)
+	if _, err := io.ReadFull(reader, packet); err != nil {
+		return nil, err
+	}
+	payload := packet[:len(packet)-int(header[4])]
+	if len(payload) < 17 || payload[0] != 20 {
+		return nil, errors.New("first packet is not a key exchange initialisation")
+	}
+	payload = payload[17:]
+
+	lists := [][]string{}
+	for range 10 {
+		if len(payload) < 4 {
+			return nil, errors.New("truncated key exchange initialisation")
+		}
+		size := binary.BigEndian.Uint32(payload)
+		if uint32(len(payload)-4) < size {
+			return nil, errors.New("truncated key exchange initialisation")
+		}
+		names := []string{}
+		if size > 0 {
+			names = strings.Split(string(payload[4:4+size]), ",")
+		}
+		lists = append(lists, names)
+		payload = payload[4+size:]
+	}
+	return lists, nil
+}
+
+// auditTLS probes the TLS versions and cipher suites accepted by the server
+// at the given address and fails if any of them is denied; it does nothing
+// unless the check has an audit policy.
+func (c *Check) auditTLS(address string) error {
+	if c.Audit == nil {
+		return nil
+	}
+	base, err := tlsconfig.New(c.TLS, hostname(address))
+	if err != nil {
+		return fmt.Errorf("error preparing TLS configuration for %s: %w", address, err)
+	}
+	// the audit is about the cryptography, the identity is verified by the check
+	base.InsecureSkipVerify = true // #nosec G402
+
+	// all the probes share the same deadline
+	timeout := c.Audit.Timeout
+	if timeout <= 0 {
+		timeout = c.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout))
+	defer cancel()
+
+	accepts := func(configure func(config *tls.Config)) (tls.ConnectionState, bool) {
+		config := base.Clone()
+		configure(config)
+		conn, err := c.dialTLS(ctx, address, config, nil)
+		if err != nil {
+			return tls.ConnectionState{}, false
+		}
+		defer conn.Close()
+		return conn.ConnectionState(), true
+	}
+
+	// offer all cipher suites, or legacy versions would only be accepted if
+	// the server supports the secure ones
+	suites := slices.Concat(tls.CipherSuites(), tls.InsecureCipherSuites())
+	all := []uint16{}
+	for _, suite := range suites {
+		all = append(all, suite.ID)
+	}
+
+	result := &AuditResult{}
+	legacy := false
+	for _, version := range []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13} {
+		state, ok := accepts(func(config *tls.Config) {
+			config.MinVersion, config.MaxVersion = version, version
+			config.CipherSuites = all
+		})
+		if !ok {
+			continue
+		}
+		slog.Debug("TLS version accepted", "address", address, "version", tls.VersionName(version))
+		result.Versions = append(result.Versions, tls.VersionName(version))
+		if version == tls.VersionTLS13 {
+			// TLS 1.3 cipher suites cannot be selected, record the negotiated one
+			result.CipherSuites = append(result.CipherSuites, tls.CipherSuiteName(state.CipherSuite))
+		} else {
+			legacy = true
+		}
+	}
+	if legacy {
+		for _, suite := range suites {
+			if !slices.ContainsFunc(suite.SupportedVersions, func(v uint16) bool { return v <= tls.VersionTLS12 }) {
+				continue
+			}
+			_, ok := accepts(func(config *tls.Config) {
+				config.MinVersion, config.MaxVersion = tls.VersionTLS10, tls.VersionTLS12
+				config.CipherSuites = []uint16{suite.ID}
+			})
+			if ok {
+				slog.Debug("TLS cipher suite accepted", "address", address, "cipher suite", suite.Name)
+				result.CipherSuites = append(result.CipherSuites, suite.Name)
+			}
+		}
+	}
+
+	deny := c.Audit.Deny
+	if len(deny) == 0 {
+		deny = DefaultTLSDeny
+	}
+	result.check(deny, result.Versions, result.CipherSuites)
+	result.Incomplete = ctx.Err() != nil
+	c.Result.Audit = result
+	if len(result.Violations) > 0 {
+		slog.Error("server accepts denied cryptography", "address", address, "violations", result.Violations)
+		return withClass(ClassAssertionFailed, fmt.Errorf("host %s accepts denied TLS versions or cipher suites: %s", address, strings.Join(result.Violations, ", ")))
+	}
+	if result.Incomplete && c.Result.warning == nil {
+		slog.Warn("TLS audit timed out", "address", address, "timeout", timeout)
+		c.Result.warning = withClass(ClassTimeout, fmt.Errorf("TLS audit of host %s did not complete within %s", address, timeout))
+	}
+	return nil
+}
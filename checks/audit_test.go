@@ -0,0 +1,187 @@
+package checks
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHAuditServer starts an SSH server offering the algorithms in the
+// given configuration; clients are never authenticated.
+func startSSHAuditServer(config ssh.Config) (string, func()) {
+	hostKey, _, _ := newTestSSHKey()
+	server := &ssh.ServerConfig{
+		Config: config,
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	server.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start SSH server: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _, _, _ = ssh.NewServerConn(conn, server)
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func TestSSHAudit(t *testing.T) {
+	modern, stop := startSSHAuditServer(ssh.Config{
+		KeyExchanges: []string{"curve25519-sha256", "ecdh-sha2-nistp256"},
+		Ciphers:      []string{"aes128-gcm@openssh.com", "chacha20-poly1305@openssh.com"},
+		MACs:         []string{"hmac-sha2-256-etm@openssh.com"},
+	})
+	defer stop()
+	legacy, stop := startSSHAuditServer(ssh.Config{
+		KeyExchanges: []string{"curve25519-sha256", "diffie-hellman-group1-sha1"},
+		Ciphers:      []string{"aes128-ctr", "3des-cbc"},
+		MACs:         []string{"hmac-sha2-256", "hmac-sha1-96"},
+	})
+	defer stop()
+
+	tests := []struct {
+		address    string
+		policy     *AuditPolicy
+		violations []string
+	}{
+		{modern, &AuditPolicy{}, nil},
+		{legacy, &AuditPolicy{}, []string{"diffie-hellman-group1-sha1", "3des-cbc", "hmac-sha1-96"}},
+		{legacy, &AuditPolicy{Deny: []string{"CBC"}}, []string{"3des-cbc"}},
+		{modern, &AuditPolicy{Deny: []string{"curve25519"}}, []string{"curve25519-sha256", "curve25519-sha256@libssh.org"}},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  test.address,
+			Protocol: SSH,
+			Timeout:  Timeout(2 * time.Second),
+			Audit:    test.policy,
+		}
+		err := check.Do()
+		switch {
+		case test.violations == nil && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.violations != nil && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.violations != nil && !strings.Contains(err.Error(), "accepts denied algorithms"):
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case check.Result.Audit == nil || len(check.Result.Audit.KEX) == 0 || len(check.Result.Audit.HostKeys) == 0 || len(check.Result.Audit.Ciphers) == 0 || len(check.Result.Audit.MACs) == 0:
+			log.Fatalf("Algorithms not recorded in test %d: %+v", i, check.Result.Audit)
+		case !slices.Equal(check.Result.Audit.Violations, test.violations):
+			log.Fatalf("Unexpected violations in test %d: expected %v, got %v", i, test.violations, check.Result.Audit.Violations)
+		}
+	}
+}
+
+func TestTLSAudit(t *testing.T) {
+	ca := newTestCA("Test Root CA")
+	modern, stop := startTLSServer(serverConfig(newTestServerCertificate(ca, time.Time{})))
+	defer stop()
+	config := serverConfig(newTestServerCertificate(ca, time.Time{}))
+	config.MinVersion = tls.VersionTLS10
+	config.MaxVersion = tls.VersionTLS12
+	config.CipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}
+	legacy, stop := startTLSServer(config)
+	defer stop()
+
+	tests := []struct {
+		address    string
+		policy     *AuditPolicy
+		versions   []string
+		violations []string
+	}{
+		{modern, &AuditPolicy{}, []string{"TLS 1.2", "TLS 1.3"}, nil},
+		{legacy, &AuditPolicy{}, []string{"TLS 1.0", "TLS 1.1", "TLS 1.2"}, []string{"TLS 1.0", "TLS 1.1", "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA"}},
+		{legacy, &AuditPolicy{Deny: []string{"rc4"}}, []string{"TLS 1.0", "TLS 1.1", "TLS 1.2"}, []string{"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA"}},
+		{modern, &AuditPolicy{Deny: []string{"TLS 1.2"}}, []string{"TLS 1.2", "TLS 1.3"}, []string{"TLS 1.2"}},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  test.address,
+			Protocol: TLS,
+			Timeout:  Timeout(2 * time.Second),
+			TLS:      &tlsconfig.Options{CA: ca.CertPEM},
+			Audit:    test.policy,
+		}
+		err := check.Do()
+		switch {
+		case test.violations == nil && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.violations != nil && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.violations != nil && !strings.Contains(err.Error(), "accepts denied TLS versions or cipher suites"):
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case check.Result.Audit == nil || !slices.Equal(check.Result.Audit.Versions, test.versions) || len(check.Result.Audit.CipherSuites) == 0:
+			log.Fatalf("Unexpected TLS versions in test %d: %+v", i, check.Result.Audit)
+		case !slices.Equal(check.Result.Audit.Violations, test.violations):
+			log.Fatalf("Unexpected violations in test %d: expected %v, got %v", i, test.violations, check.Result.Audit.Violations)
+		}
+	}
+}
+
+func TestTLSAuditTimeout(t *testing.T) {
+	ca := newTestCA("Test Root CA")
+	config := serverConfig(newTestServerCertificate(ca, time.Time{}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start TLS server: %v", err)
+	}
+	defer listener.Close()
+	// the server completes the first handshake and silently drops the
+	// following connections, as some firewalls do with the probes
+	go func() {
+		for first := true; ; first = false {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if first {
+				go func() {
+					defer conn.Close()
+					_ = tls.Server(conn, config).Handshake()
+				}()
+				continue
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	check := &Check{
+		Address:  listener.Addr().String(),
+		Protocol: TLS,
+		Timeout:  Timeout(300 * time.Millisecond),
+		TLS:      &tlsconfig.Options{CA: ca.CertPEM},
+		Audit:    &AuditPolicy{},
+	}
+	start := time.Now()
+	check.Result.err = check.Do()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		log.Fatalf("TLS audit took %s, longer than its timeout", elapsed)
+	}
+	if !check.Result.IsWarning() || check.Result.Class() != ClassTimeout || check.Result.Audit == nil || !check.Result.Audit.Incomplete {
+		log.Fatalf("Unexpected result of TLS audit timing out: %s, %+v", check.Result.String(), check.Result.Audit)
+	}
+}
@@ -0,0 +1,133 @@
+package checks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"time"
+)
+
+// BannerScript is the conversation held with the server in a banner check:
+// the greeting it sends upon connection, if any, and a sequence of payloads
+// to send, each with the response expected back.
+type BannerScript struct {
+	// Greeting is a regular expression the greeting sent by the server upon
+	// connection must match; if empty, no greeting is read.
+	Greeting string `json:"greeting,omitempty" yaml:"greeting,omitempty"`
+	// Steps is the sequence of payloads to send, in order.
+	Steps []BannerStep `json:"steps,omitempty" yaml:"steps,omitempty"`
+}
+
+// BannerStep is a payload sent to the server along with the expected response.
+type BannerStep struct {
+	// Send is the payload to send, verbatim (e.g. "QUIT\r\n").
+	Send string `json:"send,omitempty" yaml:"send,omitempty"`
+	// Expect is a regular expression the response must match; if empty, the
+	// response is not read.
+	Expect string `json:"expect,omitempty" yaml:"expect,omitempty"`
+}
+
+// BannerResult contains the text received from the server in a banner check.
+type BannerResult struct {
+	// Banner is the greeting sent by the server upon connection.
+	Banner string `json:"banner,omitempty" yaml:"banner,omitempty"`
+	// Responses are the responses matched at each step, in order.
+	Responses []string `json:"responses,omitempty" yaml:"responses,omitempty"`
+}
+
+// doBanner connects to the check's address, reads the greeting and runs the
+// script, all within the check's timeout.
+func (c *Check) doBanner() error {
+	script := c.Banner
+	if script == nil {
+		script = &BannerScript{}
+	}
+
+	conn, err := net.DialTimeout("tcp", c.Address, time.Duration(c.Timeout))
+	if err != nil {
+		slog.Error("error dialling", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error dialling %s on protocol %s: %w", c.Address, c.Protocol.String(), err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(time.Duration(c.Timeout))); err != nil {
+		return fmt.Errorf("error setting deadline on connection to %s: %w", c.Address, err)
+	}
+
+	c.Result.Banner = &BannerResult{}
+	// data received after a response, e.g. when the server answers
+	// pipelined commands at once, is left for the following steps
+	var pending bytes.Buffer
+	if script.Greeting != "" {
+		banner, err := expect(conn, &pending, script.Greeting)
+		c.Result.Banner.Banner = banner
+		if err != nil {
+			slog.Error("unexpected greeting", "address", c.Address, "greeting", banner, "error", err)
+			return fmt.Errorf("unexpected greeting from host %s: %w", c.Address, err)
+		}
+	}
+	for i, step := range script.Steps {
+		if step.Send != "" {
+			if _, err := io.WriteString(conn, step.Send); err != nil {
+				slog.Error("error sending payload", "address", c.Address, "step", i+1, "error", err)
+				return fmt.Errorf("error sending payload at step %d to host %s: %w", i+1, c.Address, err)
+			}
+		}
+		if step.Expect != "" {
+			response, err := expect(conn, &pending, step.Expect)
+			c.Result.Banner.Responses = append(c.Result.Banner.Responses, response)
+			if err != nil {
+				slog.Error("unexpected response", "address", c.Address, "step", i+1, "response", response, "error", err)
+				return fmt.Errorf("unexpected response at step %d from host %s: %w", i+1, c.Address, err)
+			}
+		}
+	}
+	slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "banner", c.Result.Banner.Banner)
+	return nil
+}
+
+// expect reads from the connection, after the data left pending by the
+// previous steps, until the data received matches the given regular
+// expression, the server closes the connection or the deadline expires; it
+// returns the data up to the end of the line where the match ends, leaving
+// any data after it pending for the following steps.
+func expect(conn net.Conn, pending *bytes.Buffer, pattern string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regular expression '%s': %w", pattern, err)
+	}
+	buffer := make([]byte, 4096)
+	for {
+		if data := pending.Bytes(); len(data) > 0 {
+			if loc := re.FindIndex(data); loc != nil {
+				end := loc[1]
+				if end == 0 || data[end-1] != '\n' {
+					if i := bytes.IndexByte(data[end:], '\n'); i >= 0 {
+						end += i + 1
+					} else {
+						end = len(data)
+					}
+				}
+				return string(pending.Next(end)), nil
+			}
+		}
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case errors.Is(err, io.EOF):
+				return pending.String(), withClass(ClassAssertionFailed, fmt.Errorf("connection closed before receiving '%s'", pattern))
+			case errors.As(err, &netErr) && netErr.Timeout() && pending.Len() == 0:
+				return pending.String(), withClass(ClassTimeout, fmt.Errorf("timed out waiting for '%s'", pattern))
+			case errors.As(err, &netErr) && netErr.Timeout():
+				return pending.String(), withClass(ClassAssertionFailed, fmt.Errorf("timed out waiting for '%s'", pattern))
+			}
+			return pending.String(), err
+		}
+		var n int
+		n, err = conn.Read(buffer)
+		pending.Write(buffer[:n])
+	}
+}
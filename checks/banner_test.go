@@ -0,0 +1,130 @@
+package checks
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startSMTPServer starts a minimal SMTP-like server, which greets clients,
+// answers EHLO and QUIT and ignores anything else.
+func startSMTPServer() (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start SMTP server: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = conn.Write([]byte("220 mail.example.com ESMTP ready\r\n"))
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					switch command := strings.ToUpper(scanner.Text()); {
+					case strings.HasPrefix(command, "EHLO"):
+						// the response is split across writes on purpose
+						_, _ = conn.Write([]byte("250-mail.example.com\r\n"))
+						time.Sleep(10 * time.Millisecond)
+						_, _ = conn.Write([]byte("250 SIZE 10240000\r\n"))
+					case command == "RSET":
+						// two responses in a single write
+						_, _ = conn.Write([]byte("250 flushed\r\n250 reset\r\n"))
+					case command == "QUIT":
+						_, _ = conn.Write([]byte("221 Bye\r\n"))
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func TestBanner(t *testing.T) {
+	address, stop := startSMTPServer()
+	defer stop()
+
+	tests := []struct {
+		script  *BannerScript
+		failure string
+	}{
+		{nil, ""},
+		{&BannerScript{Greeting: `^220 `}, ""},
+		{&BannerScript{Greeting: `^220 .*\r\n`, Steps: []BannerStep{
+			{Send: "EHLO netcheck\r\n", Expect: `(?m)^250 `},
+			{Send: "QUIT\r\n", Expect: `^221`},
+		}}, ""},
+		{&BannerScript{Steps: []BannerStep{{Send: "NOOP\r\n"}, {Send: "QUIT\r\n", Expect: `221`}}}, ""},
+		{&BannerScript{Greeting: `^554 `}, "timed out waiting for '^554 '"},
+		{&BannerScript{Greeting: `^220 `, Steps: []BannerStep{{Send: "NOOP\r\n", Expect: `^250`}}}, "unexpected response at step 1"},
+		{&BannerScript{Greeting: `^220 `, Steps: []BannerStep{{Send: "QUIT\r\n", Expect: `^250`}}}, "connection closed before receiving"},
+		{&BannerScript{Greeting: `^220 (`}, "invalid regular expression"},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  address,
+			Protocol: BANNER,
+			Timeout:  Timeout(500 * time.Millisecond),
+			Banner:   test.script,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		}
+	}
+
+	check := &Check{
+		Address:  address,
+		Protocol: BANNER,
+		Timeout:  Timeout(500 * time.Millisecond),
+		Banner: &BannerScript{Greeting: `\r\n`, Steps: []BannerStep{
+			{Send: "EHLO netcheck\r\n", Expect: `(?m)^250 .*\r\n`},
+		}},
+	}
+	if err := check.Do(); err != nil {
+		log.Fatalf("Unexpected error: %v", err)
+	}
+	if check.Result.Banner.Banner != "220 mail.example.com ESMTP ready\r\n" {
+		log.Fatalf("Unexpected banner: %q", check.Result.Banner.Banner)
+	}
+	if len(check.Result.Banner.Responses) != 1 || check.Result.Banner.Responses[0] != "250-mail.example.com\r\n250 SIZE 10240000\r\n" {
+		log.Fatalf("Unexpected responses: %q", check.Result.Banner.Responses)
+	}
+
+	// responses received together are matched by successive steps
+	check = &Check{
+		Address:  address,
+		Protocol: BANNER,
+		Timeout:  Timeout(500 * time.Millisecond),
+		Banner: &BannerScript{Greeting: `^220 `, Steps: []BannerStep{
+			{Send: "RSET\r\n", Expect: `^250 flushed`},
+			{Expect: `^250 reset`},
+			{Send: "QUIT\r\n", Expect: `^221`},
+		}},
+	}
+	if err := check.Do(); err != nil {
+		log.Fatalf("Unexpected error with responses received together: %v", err)
+	}
+	if check.Result.Banner.Banner != "220 mail.example.com ESMTP ready\r\n" || len(check.Result.Banner.Responses) != 3 ||
+		check.Result.Banner.Responses[0] != "250 flushed\r\n" || check.Result.Banner.Responses[1] != "250 reset\r\n" {
+		log.Fatalf("Unexpected responses received together: %q, %q", check.Result.Banner.Banner, check.Result.Banner.Responses)
+	}
+
+	var protocol Protocol
+	if err := protocol.FromString("expect"); err != nil || protocol != BANNER {
+		log.Fatalf("Protocol alias not recognised: %v", err)
+	}
+}
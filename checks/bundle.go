@@ -2,6 +2,7 @@ package checks
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
@@ -9,18 +10,25 @@ import (
 
 	"github.com/dihedron/netcheck/fetch"
 	"github.com/dihedron/netcheck/format"
+	"github.com/dihedron/netcheck/tlsconfig"
 	"gopkg.in/yaml.v3"
 )
 
 // Bundle represents a consistent set of checks, with some package-level defaults.
 type Bundle struct {
-	ID          string  `json:"id,omitempty" yaml:"id,omitempty"`
-	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
-	Timeout     Timeout `json:"timeout,omitempty" yaml:"timeout,omitempty"`
-	Retries     int     `json:"retries,omitempty" yaml:"retries,omitempty"`
-	Wait        Timeout `json:"wait,omitempty" yaml:"wait,omitempty"`
-	Concurrency int     `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
-	Checks      []Check `json:"checks,omitempty" yaml:"checks,omitempty"`
+	ID             string             `json:"id,omitempty" yaml:"id,omitempty"`
+	Description    string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Timeout        Timeout            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries        int                `json:"retries,omitempty" yaml:"retries,omitempty"`
+	Wait           Timeout            `json:"wait,omitempty" yaml:"wait,omitempty"`
+	ExpiryWarning  Timeout            `json:"expiry_warning,omitempty" yaml:"expiry_warning,omitempty"`
+	ExpiryCritical Timeout            `json:"expiry_critical,omitempty" yaml:"expiry_critical,omitempty"`
+	Concurrency    int                `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	TLS            *tlsconfig.Options `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Ping           *PingOptions       `json:"ping,omitempty" yaml:"ping,omitempty"`
+	MaxLatency     *MaxLatency        `json:"max_latency,omitempty" yaml:"max_latency,omitempty"`
+	Retry          *RetryPolicy       `json:"retry,omitempty" yaml:"retry,omitempty"`
+	Checks         []Check            `json:"checks,omitempty" yaml:"checks,omitempty"`
 }
 
 // New fetches the bundle data from the given path, parses it and returns a Bundle
@@ -33,31 +41,31 @@ func New(path string) (*Bundle, error) {
 		f    format.Format
 	)
 
-	if strings.HasPrefix("http://", path) || strings.HasPrefix("https://", path) || strings.HasPrefix("https-://", path) ||
-		strings.HasPrefix("http+sso://", path) || strings.HasPrefix("https+sso://", path) || strings.HasPrefix("https+sso-://", path) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "https-://") ||
+		strings.HasPrefix(path, "http+sso://") || strings.HasPrefix(path, "https+sso://") || strings.HasPrefix(path, "https+sso-://") {
 		// retrieve from URL
-		data, f, err = fetch.FromHTTP(path)
+		data, f, err = fetch.FromHTTP(path, Default.TLS)
 		if err != nil {
 			slog.Error("error fetching bundle file from HTTP(s) source", "path", path, "error", err)
 			return nil, err
 		}
-	} else if strings.HasPrefix("redis://", path) || strings.HasPrefix("rediss://", path) || strings.HasPrefix("rediss-://", path) {
+	} else if strings.HasPrefix(path, "redis://") || strings.HasPrefix(path, "rediss://") || strings.HasPrefix(path, "rediss-://") {
 		// retrieve from a Redis instance
-		data, f, err = fetch.FromRedis(path)
+		data, f, err = fetch.FromRedis(path, Default.TLS)
 		if err != nil {
 			slog.Error("error fetching bundle file from Redis source", "path", path, "error", err)
 			return nil, err
 		}
 	} else if strings.HasPrefix(path, "consulkv://") || strings.HasPrefix(path, "consulkvs://") || strings.HasPrefix(path, "consulkvs-://") {
 		// retrieve from a Consul K/V store
-		data, f, err = fetch.FromConsulKV(path)
+		data, f, err = fetch.FromConsulKV(path, Default.TLS)
 		if err != nil {
 			slog.Error("error fetching bundle file from Consul KV source", "path", path, "error", err)
 			return nil, err
 		}
 	} else if strings.HasPrefix(path, "consulsr://") || strings.HasPrefix(path, "consulsrs://") || strings.HasPrefix(path, "consulsrs-://") {
 		// retrieve from a Consul Service Registry
-		data, f, err = fetch.FromConsulSR(path)
+		data, f, err = fetch.FromConsulSR(path, Default.TLS)
 		if err != nil {
 			slog.Error("error fetching bundle file from Consul Service Registry", "path", path, "error", err)
 			return nil, err
@@ -105,6 +113,21 @@ func New(path string) (*Bundle, error) {
 	if bundle.Retries < 1 {
 		bundle.Retries = *Default.Retries
 	}
+	if err := bundle.Retry.validate(); err != nil {
+		slog.Error("invalid retry policy in bundle", "path", path, "error", err)
+		return nil, fmt.Errorf("invalid retry policy in bundle %s: %w", path, err)
+	}
+	for _, check := range bundle.Checks {
+		if err := check.Retry.validate(); err != nil {
+			slog.Error("invalid retry policy in check", "path", path, "address", check.Address, "error", err)
+			return nil, fmt.Errorf("invalid retry policy in check of %s in bundle %s: %w", check.Address, path, err)
+		}
+		// the IPv6 headers are only checked once the address is resolved
+		if err := check.MTU.validate(mtuHeaderIPv4); err != nil {
+			slog.Error("invalid MTU settings in check", "path", path, "address", check.Address, "error", err)
+			return nil, fmt.Errorf("invalid MTU settings in check of %s in bundle %s: %w", check.Address, path, err)
+		}
+	}
 
 	return bundle, nil
 }
@@ -144,6 +167,24 @@ func (b *Bundle) Check() {
 		if check.Wait <= 0 {
 			check.Wait = b.Wait
 		}
+		if check.ExpiryWarning <= 0 {
+			check.ExpiryWarning = b.ExpiryWarning
+		}
+		if check.ExpiryCritical <= 0 {
+			check.ExpiryCritical = b.ExpiryCritical
+		}
+		if check.TLS == nil {
+			check.TLS = b.TLS
+		}
+		if check.MaxLatency == nil {
+			check.MaxLatency = b.MaxLatency
+		}
+		if check.Ping != nil || b.Ping != nil {
+			check.Ping = check.Ping.withDefaults(b.Ping)
+		}
+		if check.Retry != nil || b.Retry != nil {
+			check.Retry = check.Retry.withDefaults(b.Retry)
+		}
 		inputs <- check
 	}
 	close(inputs)
@@ -168,21 +209,44 @@ func worker(inputs <-chan Check, outputs chan<- Check) {
 		if retries <= 0 {
 			retries = 1
 		}
+		start := time.Now()
+		var history []Attempt
 	attempts:
 		for i := range retries {
 			err = check.Do()
+			history = append(history, newAttempt(check.Result, err))
 			if err != nil {
 				slog.Warn("check failed", "id", check.id, "attempt", i+1, "error", err)
-				time.Sleep(time.Duration(check.Wait))
+				if i == retries-1 {
+					break attempts
+				}
+				if !check.Retry.retryable(err) {
+					slog.Warn("check failure not worth retrying", "id", check.id, "class", classify(err))
+					break attempts
+				}
+				time.Sleep(check.Retry.wait(i+1, check.Wait))
 			} else {
 				slog.Debug("check successful", "id", check.id)
 				break attempts
 			}
 		}
-		// update the error in the check and return it
-		check.Result = Result{
-			err: err,
+		check.Result.History = history
+		check.Result.Timing.Start = start
+		check.Result.Timing.Attempts = len(history)
+		check.Result.Timing.Total = Timeout(time.Since(start))
+		if err != nil && check.TraceOnFailure && check.Result.Trace == nil {
+			// find out where the traffic dies
+			trace, terr := check.trace()
+			if terr != nil {
+				slog.Warn("error tracing route", "id", check.id, "address", check.Address, "error", terr)
+			}
+			check.Result.Trace = trace
+		}
+		if err != nil && check.Explain {
+			check.Result.Explanation = check.explain(err)
 		}
+		// update the error in the check and return it
+		check.Result.err = err
 		outputs <- check
 	}
 }
@@ -2,34 +2,76 @@ package checks
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log/slog"
 	"net"
-	"net/http"
-	"runtime"
-	"strings"
 	"time"
 
-	"github.com/dpotapov/go-spnego"
-	probing "github.com/prometheus-community/pro-bing"
-	"golang.org/x/crypto/ssh"
+	"github.com/dihedron/netcheck/tlsconfig"
 	"gopkg.in/yaml.v3"
 )
 
 // Check represents a single check to perform.
 type Check struct {
-	id       int
-	Name     string   `json:"name,omitempty" yaml:"name,omitempty"`
-	Timeout  Timeout  `json:"timeout,omitempty" yaml:"timeout,omitempty"`
-	Retries  int      `json:"retries,omitempty" yaml:"retries,omitempty"`
-	Wait     Timeout  `json:"wait,omitempty" yaml:"wait,omitempty"`
-	Address  string   `json:"address,omitempty" yaml:"address,omitempty"`
-	Protocol Protocol `json:"protocol" yaml:"protocol"`
-	SSO      bool     `json:"sso" yaml:"sso"` // whether to use single-sign-on authentication
-	Result   Result   `json:"result" yaml:"result"`
+	id             int
+	Name           string             `json:"name,omitempty" yaml:"name,omitempty"`
+	Timeout        Timeout            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries        int                `json:"retries,omitempty" yaml:"retries,omitempty"`
+	Wait           Timeout            `json:"wait,omitempty" yaml:"wait,omitempty"`
+	Retry          *RetryPolicy       `json:"retry,omitempty" yaml:"retry,omitempty"`                     // how long to wait between attempts and which failures to retry
+	ExpiryWarning  Timeout            `json:"expiry_warning,omitempty" yaml:"expiry_warning,omitempty"`   // certificates expiring within this threshold cause a warning
+	ExpiryCritical Timeout            `json:"expiry_critical,omitempty" yaml:"expiry_critical,omitempty"` // certificates expiring within this threshold cause a failure
+	Address        string             `json:"address,omitempty" yaml:"address,omitempty"`
+	Protocol       Protocol           `json:"protocol" yaml:"protocol"`
+	SSO            bool               `json:"sso" yaml:"sso"` // whether to use single-sign-on authentication
+	Ping           *PingOptions       `json:"ping,omitempty" yaml:"ping,omitempty"`
+	MTU            *MTUOptions        `json:"mtu,omitempty" yaml:"mtu,omitempty"`
+	Traceroute     *TraceOptions      `json:"traceroute,omitempty" yaml:"traceroute,omitempty"`
+	TraceOnFailure bool               `json:"trace_on_failure,omitempty" yaml:"trace_on_failure,omitempty"` // trace the route to the host if the check fails
+	Explain        bool               `json:"explain,omitempty" yaml:"explain,omitempty"`                   // diagnose the failing network layer if the check fails
+	DNS            *DNSQuery          `json:"dns,omitempty" yaml:"dns,omitempty"`
+	UDP            *UDPProbe          `json:"udp,omitempty" yaml:"udp,omitempty"`
+	Banner         *BannerScript      `json:"banner,omitempty" yaml:"banner,omitempty"`
+	Database       *DatabaseOptions   `json:"database,omitempty" yaml:"database,omitempty"`
+	GRPC           *GRPCOptions       `json:"grpc,omitempty" yaml:"grpc,omitempty"`
+	SSH            *SSHOptions        `json:"ssh,omitempty" yaml:"ssh,omitempty"`
+	HTTP           *HTTPRequest       `json:"http,omitempty" yaml:"http,omitempty"`
+	TLS            *tlsconfig.Options `json:"tls,omitempty" yaml:"tls,omitempty"`
+	StartTLS       string             `json:"starttls,omitempty" yaml:"starttls,omitempty"` // protocol used to upgrade the connection to TLS (smtp, imap, pop3, ldap, ftp, postgres)
+	DTLS           *DTLSOptions       `json:"dtls,omitempty" yaml:"dtls,omitempty"`
+	Certificate    *CertificateExpect `json:"certificate,omitempty" yaml:"certificate,omitempty"`
+	Audit          *AuditPolicy       `json:"audit,omitempty" yaml:"audit,omitempty"`
+	MaxLatency     *MaxLatency        `json:"max_latency,omitempty" yaml:"max_latency,omitempty"` // checks taking longer cause a warning or a failure
+	Result         Result             `json:"result" yaml:"result"`
+}
+
+// check is used to marshal the Check without recursing into its custom
+// marshalling methods.
+type check Check
+
+// MarshalJSON produces the JSON value for the Check, with the message of the
+// result under "result" and its status and details under "details".
+func (c Check) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		check
+		Details details `json:"details"`
+	}{
+		check:   check(c),
+		Details: details(c.Result),
+	})
+}
+
+// MarshalYAML returns the YAML value for the Check, with the message of the
+// result under "result" and its status and details under "details".
+func (c Check) MarshalYAML() (any, error) {
+	return struct {
+		check   `yaml:",inline"`
+		Details details `yaml:"details"`
+	}{
+		check:   check(c),
+		Details: details(c.Result),
+	}, nil
 }
 
 // ToJSON converts the Check to its JSON pretty representation.
@@ -44,123 +86,61 @@ func (c *Check) ToYAML() string {
 	return string(data)
 }
 
-// Do performs the actual check.
+// Do performs the actual check, timing it and verifying the latency
+// thresholds if it succeeds.
 func (c *Check) Do() error {
-	var protocol string
+	// clear any details left over by a previous attempt
+	timing := &Timing{Start: time.Now(), Attempts: 1}
+	c.Result = Result{Timing: timing}
+
+	err := c.do()
+	// the result gets its own copy, out of reach of the callbacks of the
+	// connections that outlive the attempt
+	c.Result.Timing = timing.seal()
+	if err != nil {
+		return err
+	}
+	return c.verifyLatency()
+}
+
+// do performs the protocol-specific check.
+func (c *Check) do() error {
 	switch c.Protocol {
-	case TCP, UDP:
+	case TCP:
 		var dialer net.Dialer
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.Timeout))
 		defer cancel()
-		conn, err := dialer.DialContext(ctx, c.Protocol.String(), c.Address)
+		conn, err := dialer.DialContext(c.Result.Timing.trace(ctx), c.Protocol.String(), c.Address)
 		if err != nil {
 			slog.Error("error dialling", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
 			return fmt.Errorf("error dialling %s on protocol %s: %w", c.Address, c.Protocol.String(), err)
 		}
 		defer conn.Close()
 		slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String())
+	case UDP:
+		return c.doUDP()
 	case DTLS:
-		protocol = "udp"
-		// the rest of the logic is identical to the TLS case, so...
-		fallthrough
+		return c.doDTLS()
 	case TLS:
-		if protocol != "udp" {
-			protocol = "tcp"
-		}
-		dialer := &net.Dialer{
-			Timeout: time.Duration(c.Timeout),
-		}
-		conn, err := tls.DialWithDialer(dialer, protocol, c.Address, nil)
-		if err != nil {
-			slog.Error("error dialling", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
-			return fmt.Errorf("error dialling %s on protocol %s: %w", c.Address, c.Protocol.String(), err)
-		}
-		defer conn.Close()
-		err = conn.VerifyHostname(strings.Split(c.Address, ":")[0])
-		if err != nil {
-			slog.Error("hostname does not match certificate", "hostname", strings.Split(c.Address, ":")[0], "error", err)
-			return fmt.Errorf("hostname mismatch in certificate from host %s on protocol %s: %w", c.Address, c.Protocol.String(), err)
-		}
-		expiry := conn.ConnectionState().PeerCertificates[0].NotAfter
-		issuer := conn.ConnectionState().PeerCertificates[0].Issuer
-		if time.Now().After(expiry) {
-			slog.Error("certificate has expired", "expiry", expiry.Format(time.RFC3339))
-			return fmt.Errorf("certificate from host %s on protocol %s expired on %s", c.Address, c.Protocol.String(), expiry.Format(time.RFC3339))
-		}
-		slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "certificate issuer", issuer, "certificate expiry", expiry.Format(time.RFC3339))
+		return c.doTLS()
 	case ICMP:
-		pinger, err := probing.NewPinger(c.Address)
-		if runtime.GOOS == "windows" || runtime.GOOS == "linux" {
-			// on linux, package post install must run:
-			// setcap cap_net_raw=+ep /path/to/your/netcheck
-			// for unprivileged ping to work
-			pinger.SetPrivileged(true)
-		}
-
-		if err != nil {
-			slog.Error("error creating ICMP client", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
-			return fmt.Errorf("expired creating ICMP client to %s: %w", c.Address, err)
-		}
-		// TODO: take these parameters from configuration/bundle/CLI
-		pinger.Timeout = time.Duration(c.Timeout)
-		pinger.Count = *Default.Ping.Count
-		pinger.Interval = time.Duration(*Default.Ping.Interval)
-		pinger.Size = *Default.Ping.Size
-
-		pinger.OnRecv = func(pkt *probing.Packet) {
-			slog.Debug("received ping response", "bytes", pkt.Nbytes, "endpoint", pkt.IPAddr, "sequence", pkt.Seq, "rtt", pkt.Rtt, "ttl", pkt.TTL)
-		}
-
-		pinger.OnDuplicateRecv = func(pkt *probing.Packet) {
-			slog.Debug("received duplicate ping response", "bytes", pkt.Nbytes, "endpoint", pkt.IPAddr, "sequence", pkt.Seq, "rtt", pkt.Rtt, "ttl", pkt.TTL)
-		}
-
-		pinger.OnFinish = func(stats *probing.Statistics) {
-			slog.Debug("ping statistics", "destination", stats.Addr, "transmitted", stats.PacketsSent, "received", stats.PacketsRecv, "loss_percent", stats.PacketLoss, "roundtrip_min", stats.MinRtt, "roundtrip_avg", stats.AvgRtt, "roundtrip_max", stats.MaxRtt, "roundtrip_stddev", stats.StdDevRtt)
-		}
-
-		err = pinger.Run()
-		if err != nil {
-			slog.Error("error running ping", "endpoint", c.Address, "protocol", c.Protocol.String(), "error", err)
-			return fmt.Errorf("error running ping against %s: %w", c.Address, err)
-		}
-		slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String())
+		return c.doICMP()
+	case MTU:
+		return c.doMTU()
+	case TRACEROUTE:
+		return c.doTraceroute()
 	case SSH:
-		config := &ssh.ClientConfig{
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			Timeout:         time.Duration(c.Timeout),
-		}
-		client, err := ssh.Dial("tcp", c.Address, config)
-		if err != nil && !strings.Contains(err.Error(), "ssh: unable to authenticate") {
-			slog.Error("error running ssh session", "address", c.Address, "protocol", c.Protocol.String(), "error", err, "type", fmt.Sprintf("%T", errors.Unwrap(err)))
-			return fmt.Errorf("error opening SSH session to %s: %w", c.Address, err)
-		}
-		if client != nil {
-			defer client.Close()
-		}
+		return c.doSSH()
 	case HTTP, HTTPS:
-		client := http.DefaultClient
-
-		if c.SSO {
-			// create an NTM-aware transport
-			client.Transport = &spnego.Transport{}
-			// ensure that the HTTP_PROXY* variables are honoured
-			client.Transport.(*spnego.Transport).Transport = *http.DefaultTransport.(*http.Transport).Clone()
-		} else {
-			// ensure that the HTTP_PROXY* variables are honoured
-			client.Transport = http.DefaultTransport.(*http.Transport).Clone()
-		}
-
-		address := c.Protocol.String() + "://" + c.Address
-
-		slog.Debug("placing request to HTTP(s) server", "url", address)
-
-		resp, err := client.Get(address)
-		if err != nil {
-			slog.Error("error connecting to HTTP(s) web site", "address", address, "protocol", c.Protocol.String(), "error", err, "type", fmt.Sprintf("%T", errors.Unwrap(err)))
-			return fmt.Errorf("error connecting to HTTP(s) web site %s: %w", address, err)
-		}
-		defer resp.Body.Close()
+		return c.doHTTP()
+	case DNS:
+		return c.doDNS()
+	case BANNER:
+		return c.doBanner()
+	case POSTGRES, MYSQL, REDIS:
+		return c.doDatabase()
+	case GRPC, GRPCS:
+		return c.doGRPC()
 	}
 	return nil
 }
@@ -0,0 +1,204 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pion/dtls/v3"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorClass is the class of the error that made a check fail (or of its
+// warning), for consumers that need to tell failures apart without parsing
+// the human readable message.
+type ErrorClass string
+
+const (
+	// ClassDNS is a failure to resolve a name, or an error returned by the
+	// DNS server in DNS checks.
+	ClassDNS ErrorClass = "dns_failure"
+	// ClassTimeout is a host that did not answer in time.
+	ClassTimeout ErrorClass = "timeout"
+	// ClassConnectionRefused is a connection actively refused by the host,
+	// or an ICMP port unreachable in UDP checks.
+	ClassConnectionRefused ErrorClass = "connection_refused"
+	// ClassConnectionReset is a connection reset by the peer.
+	ClassConnectionReset ErrorClass = "connection_reset"
+	// ClassNetworkUnreachable is a network with no route to it.
+	ClassNetworkUnreachable ErrorClass = "network_unreachable"
+	// ClassHostUnreachable is a host that cannot be reached.
+	ClassHostUnreachable ErrorClass = "host_unreachable"
+	// ClassTLSHandshake is a failed TLS or DTLS handshake.
+	ClassTLSHandshake ErrorClass = "tls_handshake"
+	// ClassCertificateExpired is a certificate past its expiry date.
+	ClassCertificateExpired ErrorClass = "certificate_expired"
+	// ClassCertificateExpiring is a certificate expiring within the
+	// critical or warning threshold.
+	ClassCertificateExpiring ErrorClass = "certificate_expiring"
+	// ClassCertificateUntrusted is a certificate that could not be verified
+	// against the trusted CAs.
+	ClassCertificateUntrusted ErrorClass = "certificate_untrusted"
+	// ClassHostnameMismatch is a certificate not valid for the host.
+	ClassHostnameMismatch ErrorClass = "hostname_mismatch"
+	// ClassAuthFailed is a server rejecting the configured credentials.
+	ClassAuthFailed ErrorClass = "auth_failed"
+	// ClassAssertionFailed is a server that answered, but not as expected
+	// (e.g. an unexpected HTTP status code or a pinned certificate mismatch).
+	ClassAssertionFailed ErrorClass = "assertion_failed"
+	// ClassLatency is a check that succeeded, but took longer than its
+	// latency thresholds.
+	ClassLatency ErrorClass = "latency_exceeded"
+	// ClassProtocol is a server that does not speak the expected protocol.
+	ClassProtocol ErrorClass = "protocol_error"
+	// ClassUnknown is any other error.
+	ClassUnknown ErrorClass = "unknown"
+)
+
+// errorClasses lists all the known error classes.
+var errorClasses = []ErrorClass{
+	ClassDNS,
+	ClassTimeout,
+	ClassConnectionRefused,
+	ClassConnectionReset,
+	ClassNetworkUnreachable,
+	ClassHostUnreachable,
+	ClassTLSHandshake,
+	ClassCertificateExpired,
+	ClassCertificateExpiring,
+	ClassCertificateUntrusted,
+	ClassHostnameMismatch,
+	ClassAuthFailed,
+	ClassAssertionFailed,
+	ClassLatency,
+	ClassProtocol,
+	ClassUnknown,
+}
+
+// classified is an error with an explicit class, for the failures that
+// cannot be recognised from the underlying error (e.g. failed assertions).
+type classified struct {
+	class ErrorClass
+	err   error
+}
+
+// Error returns the message of the underlying error.
+func (e *classified) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *classified) Unwrap() error {
+	return e.err
+}
+
+// withClass attaches the given class to the error.
+func withClass(class ErrorClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classified{class: class, err: err}
+}
+
+// classify returns the class of the error, derived from the class attached
+// with withClass if any, or else from the type of the underlying network,
+// system call, certificate and client library errors.
+func classify(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	var explicit *classified
+	if errors.As(err, &explicit) {
+		return explicit.class
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ClassDNS
+	}
+
+	// certificate errors, checked before timeouts and handshake errors as
+	// the TLS stack wraps them
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) {
+		if invalidErr.Reason == x509.Expired {
+			return ClassCertificateExpired
+		}
+		return ClassCertificateUntrusted
+	}
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		return ClassHostnameMismatch
+	}
+	var authorityErr x509.UnknownAuthorityError
+	if errors.As(err, &authorityErr) {
+		return ClassCertificateUntrusted
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ClassConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return ClassConnectionReset
+	case errors.Is(err, syscall.ENETUNREACH):
+		return ClassNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return ClassHostUnreachable
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ClassTimeout
+	}
+
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var dtlsErr *dtls.HandshakeError
+	if errors.As(err, &alertErr) || errors.As(err, &recordErr) || errors.As(err, &verifyErr) || errors.As(err, &dtlsErr) {
+		return ClassTLSHandshake
+	}
+
+	// authentication errors of the client libraries
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "28") {
+		return ClassAuthFailed
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) && (myErr.Number == 1044 || myErr.Number == 1045) {
+		return ClassAuthFailed
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) && (strings.HasPrefix(redisErr.Error(), "NOAUTH") || strings.HasPrefix(redisErr.Error(), "WRONGPASS")) {
+		return ClassAuthFailed
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.DeadlineExceeded:
+			return ClassTimeout
+		case codes.Unauthenticated, codes.PermissionDenied:
+			return ClassAuthFailed
+		}
+	}
+
+	// errors with no distinct type
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "ssh: unable to authenticate"):
+		return ClassAuthFailed
+	case strings.Contains(message, "tls: "):
+		return ClassTLSHandshake
+	}
+	return ClassUnknown
+}
@@ -0,0 +1,75 @@
+package checks
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+	"gopkg.in/yaml.v3"
+)
+
+func TestClassify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	ca := newTestCA("Test Root CA")
+	secure, stop := startTLSServer(serverConfig(newTestServerCertificate(ca, time.Time{})))
+	defer stop()
+	expired, stop := startTLSServer(serverConfig(newTestServerCertificate(ca, time.Now().Add(-time.Minute))))
+	defer stop()
+	expiring, stop := startTLSServer(serverConfig(newTestServerCertificate(ca, time.Now().Add(24*time.Hour))))
+	defer stop()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start TCP server: %v", err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		check *Check
+		class ErrorClass
+	}{
+		{&Check{Address: closed.Addr().String(), Protocol: TCP}, ClassConnectionRefused},
+		{&Check{Address: "netcheck.invalid:80", Protocol: TCP}, ClassDNS},
+		{&Check{Address: secure, Protocol: TLS}, ClassCertificateUntrusted},
+		{&Check{Address: secure, Protocol: TLS, TLS: &tlsconfig.Options{CA: ca.CertPEM, ServerName: "other.example.com"}}, ClassHostnameMismatch},
+		{&Check{Address: expired, Protocol: TLS, TLS: &tlsconfig.Options{CA: ca.CertPEM}}, ClassCertificateExpired},
+		{&Check{Address: expired, Protocol: TLS, TLS: &tlsconfig.Options{Insecure: true}}, ClassCertificateExpired},
+		{&Check{Address: secure, Protocol: TLS, TLS: &tlsconfig.Options{CA: ca.CertPEM}, Certificate: &CertificateExpect{IssuerCN: "Other CA"}}, ClassAssertionFailed},
+		{&Check{Address: expiring, Protocol: TLS, TLS: &tlsconfig.Options{CA: ca.CertPEM}, ExpiryWarning: Timeout(48 * time.Hour)}, ClassCertificateExpiring},
+		{&Check{Address: strings.TrimPrefix(server.URL, "http://"), Protocol: HTTP}, ClassAssertionFailed},
+		{&Check{Address: strings.TrimPrefix(server.URL, "http://"), Protocol: HTTP, HTTP: &HTTPRequest{Expect: &HTTPExpect{Status: []string{"503"}}}}, ""},
+	}
+
+	for i, test := range tests {
+		test.check.Timeout = Timeout(2 * time.Second)
+		test.check.Result.err = test.check.Do()
+		if class := test.check.Result.Class(); class != test.class {
+			log.Fatalf("Unexpected class in test %d: expected '%s', got '%s' (%s)", i, test.class, class, test.check.Result.String())
+		}
+		data, _ := json.Marshal(test.check)
+		if message, _ := json.Marshal(test.check.Result.String()); !strings.Contains(string(data), `"result":`+string(message)) {
+			log.Fatalf("Message not in JSON result in test %d: %s", i, data)
+		}
+		if test.class != "" && !strings.Contains(string(data), `"class":"`+string(test.class)+`"`) {
+			log.Fatalf("Class not in JSON result in test %d: %s", i, data)
+		}
+		if test.class == "" && strings.Contains(string(data), `"class"`) {
+			log.Fatalf("Unexpected class in JSON result in test %d: %s", i, data)
+		}
+		data, _ = yaml.Marshal(test.check)
+		if !strings.Contains(string(data), "\nresult: ") || !strings.Contains(string(data), "\ndetails:\n    status: "+test.check.Result.Status().String()) {
+			log.Fatalf("Result not in YAML check in test %d: %s", i, data)
+		}
+		if test.class != "" && !strings.Contains(string(data), "class: "+string(test.class)) {
+			log.Fatalf("Class not in YAML result in test %d: %s", i, data)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package checks
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+	"github.com/dpotapov/go-spnego"
+)
+
+// transportOptions contains the settings that identify a shared HTTP transport:
+// checks with the same settings share the same transport and, with it, the pool
+// of idle connections towards each host.
+type transportOptions struct {
+	timeout Timeout
+	tls     tlsconfig.Options
+	proxy   string
+}
+
+// transports is the cache of HTTP transports shared among checks.
+var transports = struct {
+	sync.Mutex
+	cache map[transportOptions]*http.Transport
+}{
+	cache: map[transportOptions]*http.Transport{},
+}
+
+// newHTTPClient returns a new HTTP client for the given check; the client is
+// never shared among checks, whereas its underlying transport is shared among
+// all the checks with the same settings, so connections can be reused.
+func (c *Check) newHTTPClient() (*http.Client, error) {
+	options := c.HTTP
+	if options == nil {
+		options = &HTTPRequest{}
+	}
+
+	settings := transportOptions{
+		timeout: c.Timeout,
+		proxy:   options.Proxy,
+	}
+	if c.TLS != nil {
+		settings.tls = *c.TLS
+	}
+	if options.Insecure {
+		settings.tls.Insecure = true
+	}
+
+	transport, err := getTransport(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport:     transport,
+		Timeout:       time.Duration(c.Timeout),
+		CheckRedirect: options.checkRedirect,
+	}
+	if c.SSO {
+		client.Transport = &ssoTransport{
+			transport: transport,
+		}
+	}
+	return client, nil
+}
+
+// getTransport returns the shared transport for the given settings, creating
+// it if necessary.
+func getTransport(options transportOptions) (*http.Transport, error) {
+	transports.Lock()
+	defer transports.Unlock()
+
+	if transport, ok := transports.cache[options]; ok {
+		return transport, nil
+	}
+
+	// start from the default transport, so the HTTP_PROXY* variables are honoured
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options.timeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   time.Duration(options.timeout),
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = time.Duration(options.timeout)
+	}
+	config, err := tlsconfig.New(&options.tls, "")
+	if err != nil {
+		slog.Error("error preparing TLS configuration", "error", err)
+		return nil, fmt.Errorf("error preparing TLS configuration: %w", err)
+	}
+	transport.TLSClientConfig = config
+	switch strings.ToLower(options.proxy) {
+	case "":
+		// keep the proxy from the environment
+	case "none", "direct":
+		transport.Proxy = nil
+	default:
+		u, err := url.Parse(options.proxy)
+		if err != nil {
+			slog.Error("error parsing proxy URL", "proxy", options.proxy, "error", err)
+			return nil, fmt.Errorf("invalid proxy URL '%s': %w", options.proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	transports.cache[options] = transport
+	return transport, nil
+}
+
+// sso holds the SPNEGO provider shared by all SSO-enabled checks; providers
+// initialise their state lazily and are not safe for concurrent use, hence
+// the mutex.
+var sso = struct {
+	sync.Mutex
+	provider spnego.Provider
+}{}
+
+// ssoTransport is an HTTP transport that adds the Kerberos/NTLM (SPNEGO)
+// authentication header to each request before passing it on to the shared
+// underlying transport.
+type ssoTransport struct {
+	transport http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *ssoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// round trippers must not modify the original request
+	req = req.Clone(req.Context())
+
+	sso.Lock()
+	if sso.provider == nil {
+		sso.provider = spnego.New()
+	}
+	err := sso.provider.SetSPNEGOHeader(req, true)
+	sso.Unlock()
+	if err != nil {
+		return nil, &spnego.Error{Err: err}
+	}
+	return t.transport.RoundTrip(req)
+}
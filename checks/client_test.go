@@ -0,0 +1,149 @@
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientSharedTransport(t *testing.T) {
+	first := &Check{Address: "www.example.com", Protocol: HTTPS, Timeout: Timeout(3 * time.Second)}
+	second := &Check{Address: "www.example.com/other", Protocol: HTTPS, Timeout: Timeout(3 * time.Second), SSO: true}
+	third := &Check{Address: "www.example.com", Protocol: HTTPS, Timeout: Timeout(3 * time.Second), HTTP: &HTTPRequest{Insecure: true}}
+
+	clients := []*http.Client{}
+	for _, check := range []*Check{first, second, third} {
+		client, err := check.newHTTPClient()
+		if err != nil {
+			log.Fatalf("Could not create HTTP client: %v", err)
+		}
+		clients = append(clients, client)
+	}
+
+	if clients[0] == clients[1] {
+		log.Fatalf("HTTP clients must not be shared among checks")
+	}
+	if sso, ok := clients[1].Transport.(*ssoTransport); !ok || sso.transport != clients[0].Transport {
+		log.Fatalf("Checks with the same settings must share the underlying transport")
+	}
+	if clients[2].Transport == clients[0].Transport {
+		log.Fatalf("Checks with different TLS settings must not share the transport")
+	}
+	if clients[0].Timeout != 3*time.Second {
+		log.Fatalf("Check timeout not honoured by the HTTP client: %v", clients[0].Timeout)
+	}
+	if _, err := (&Check{HTTP: &HTTPRequest{Proxy: "://invalid"}}).newHTTPClient(); err == nil {
+		log.Fatalf("Expected error with invalid proxy URL, got none")
+	}
+}
+
+// fakeProvider is a SPNEGO provider issuing a distinct token for each
+// request; like the real ones it is not safe for concurrent use, so it fails
+// the requests if it is ever called concurrently.
+type fakeProvider struct {
+	busy   bool
+	issued int
+}
+
+// SetSPNEGOHeader implements the spnego.Provider interface.
+func (p *fakeProvider) SetSPNEGOHeader(req *http.Request, canonicalize bool) error {
+	if p.busy {
+		return errors.New("SPNEGO provider used concurrently")
+	}
+	p.busy = true
+	defer func() { p.busy = false }()
+	// widen the window for concurrent calls
+	time.Sleep(time.Millisecond)
+	p.issued++
+	req.Header.Set("Authorization", fmt.Sprintf("Negotiate token-%d", p.issued))
+	return nil
+}
+
+func TestHTTPConcurrentSSO(t *testing.T) {
+	provider := &fakeProvider{}
+	sso.Lock()
+	previous := sso.provider
+	sso.provider = provider
+	sso.Unlock()
+	defer func() {
+		sso.Lock()
+		sso.provider = previous
+		sso.Unlock()
+	}()
+
+	var mu sync.Mutex
+	var requests int
+	tokens := map[string]string{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if token := r.Header.Get("Authorization"); token != "" {
+			tokens[token] = r.URL.Query().Get("check")
+		}
+		fmt.Fprint(w, "OK")
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	bundle := &Bundle{
+		Timeout:     Timeout(5 * time.Second),
+		Retries:     1,
+		Wait:        Timeout(10 * time.Millisecond),
+		Concurrency: 10,
+	}
+	for i := range 60 {
+		check := Check{
+			Name: fmt.Sprintf("check-%d", i),
+			SSO:  i%3 == 0,
+		}
+		if i%2 == 0 {
+			check.Protocol = HTTP
+			check.Address = strings.TrimPrefix(plain.URL, "http://")
+		} else {
+			check.Protocol = HTTPS
+			check.Address = strings.TrimPrefix(secure.URL, "https://")
+			check.HTTP = &HTTPRequest{Insecure: true}
+		}
+		check.Address += "/?check=" + check.Name
+		bundle.Checks = append(bundle.Checks, check)
+	}
+
+	bundle.Check()
+
+	expected := map[string]bool{}
+	for _, check := range bundle.Checks {
+		if check.Result.IsError() {
+			log.Fatalf("Unexpected error on check %s: %v", check.Name, check.Result.err)
+		}
+		if check.SSO {
+			expected[check.Name] = true
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != len(bundle.Checks) {
+		log.Fatalf("Unexpected number of requests reaching the server: expected %d, got %d", len(bundle.Checks), requests)
+	}
+	// each SSO check sent its own token, and no other check sent any
+	if len(tokens) != len(expected) || provider.issued != len(expected) {
+		log.Fatalf("Unexpected SPNEGO tokens: expected %d, got %d (%d issued)", len(expected), len(tokens), provider.issued)
+	}
+	for token, name := range tokens {
+		if !expected[name] {
+			log.Fatalf("Unexpected token %s from non-SSO check %s", token, name)
+		}
+		delete(expected, name)
+	}
+	if len(expected) > 0 {
+		log.Fatalf("No token received from SSO checks %v", expected)
+	}
+}
@@ -0,0 +1,250 @@
+package checks
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultDatabaseUser is the user sent in the handshake with database servers
+// when no credentials are configured.
+const DefaultDatabaseUser = "netcheck"
+
+// DatabaseOptions contains the settings of PostgreSQL, MySQL and Redis checks;
+// credentials are read from environment variables.
+type DatabaseOptions struct {
+	// UsernameEnv is the name of the variable holding the username.
+	UsernameEnv string `json:"username_env,omitempty" yaml:"username_env,omitempty"`
+	// PasswordEnv is the name of the variable holding the password.
+	PasswordEnv string `json:"password_env,omitempty" yaml:"password_env,omitempty"`
+	// Name is the database to connect to (the database number for Redis).
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Query is a statement (e.g. "SELECT 1") or, for Redis, a command (e.g.
+	// "PING") to run once connected.
+	Query string `json:"query,omitempty" yaml:"query,omitempty"`
+}
+
+// DatabaseResult contains the details collected in database checks.
+type DatabaseResult struct {
+	// Version is the version reported by the server.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Authenticated is whether the check logged into the server.
+	Authenticated bool `json:"authenticated" yaml:"authenticated"`
+}
+
+// credentials returns the username and password from the environment; if no
+// credentials are configured, the default user is returned and the boolean
+// is false.
+func (o *DatabaseOptions) credentials() (string, string, bool, error) {
+	if o == nil || (o.UsernameEnv == "" && o.PasswordEnv == "") {
+		return DefaultDatabaseUser, "", false, nil
+	}
+	var username, password string
+	if o.UsernameEnv != "" {
+		value, ok := os.LookupEnv(o.UsernameEnv)
+		if !ok {
+			return "", "", false, fmt.Errorf("environment variable '%s' with database username is not set", o.UsernameEnv)
+		}
+		username = value
+	}
+	if o.PasswordEnv != "" {
+		value, ok := os.LookupEnv(o.PasswordEnv)
+		if !ok {
+			return "", "", false, fmt.Errorf("environment variable '%s' with database password is not set", o.PasswordEnv)
+		}
+		password = value
+	}
+	return username, password, true, nil
+}
+
+// doDatabase performs the handshake with a PostgreSQL, MySQL or Redis server,
+// authenticating if credentials are configured and running the optional query;
+// without credentials, a server rejecting the login in the authentication
+// phase is considered healthy, as it got that far in the handshake.
+func (c *Check) doDatabase() error {
+	options := c.Database
+	if options == nil {
+		options = &DatabaseOptions{}
+	}
+	username, password, authenticate, err := options.credentials()
+	if err != nil {
+		slog.Error("error reading database credentials", "address", c.Address, "error", err)
+		return fmt.Errorf("error reading credentials for %s: %w", c.Address, err)
+	}
+
+	var config *tls.Config
+	if c.TLS != nil {
+		if config, err = tlsconfig.New(c.TLS, hostname(c.Address)); err != nil {
+			slog.Error("error preparing TLS configuration", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+			return fmt.Errorf("error preparing TLS configuration for %s: %w", c.Address, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.Timeout))
+	defer cancel()
+
+	c.Result.Database = &DatabaseResult{}
+	switch c.Protocol {
+	case POSTGRES:
+		err = c.doPostgres(ctx, options, username, password, config)
+		var pgErr *pgconn.PgError
+		if !authenticate && errors.As(err, &pgErr) && pgErr.Code == "28P01" {
+			// invalid password: the server accepts connections from this host
+			slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "authentication", "rejected")
+			return nil
+		}
+	case MYSQL:
+		err = c.doMySQL(ctx, options, username, password, config)
+		var myErr *mysql.MySQLError
+		if !authenticate && errors.As(err, &myErr) && myErr.Number == 1045 {
+			// access denied: the server accepts connections from this host
+			slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "authentication", "rejected")
+			return nil
+		}
+	case REDIS:
+		err = c.doRedis(ctx, options, username, password, authenticate, config)
+		if !authenticate && err != nil && strings.HasPrefix(err.Error(), "NOAUTH") {
+			// authentication required: the server is up and answering
+			slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "authentication", "required")
+			return nil
+		}
+	}
+	if err != nil {
+		slog.Error("error performing database handshake", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error performing %s handshake with %s: %w", c.Protocol.String(), c.Address, err)
+	}
+	c.Result.Database.Authenticated = authenticate
+	slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "version", c.Result.Database.Version)
+	return nil
+}
+
+// doPostgres connects to a PostgreSQL server.
+func (c *Check) doPostgres(ctx context.Context, options *DatabaseOptions, username, password string, config *tls.Config) error {
+	host, port, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port '%s': %w", port, err)
+	}
+	settings, err := pgconn.ParseConfig("")
+	if err != nil {
+		return err
+	}
+	settings.Host = host
+	settings.Port = uint16(number)
+	settings.User = username
+	settings.Password = password
+	settings.Database = options.Name
+	settings.TLSConfig = config
+	settings.Fallbacks = nil
+
+	conn, err := pgconn.ConnectConfig(ctx, settings)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	c.Result.Database.Version = conn.ParameterStatus("server_version")
+	if options.Query != "" {
+		if _, err := conn.Exec(ctx, options.Query).ReadAll(); err != nil {
+			return fmt.Errorf("error running query: %w", err)
+		}
+	}
+	return nil
+}
+
+// doMySQL connects to a MySQL server.
+func (c *Check) doMySQL(ctx context.Context, options *DatabaseOptions, username, password string, config *tls.Config) error {
+	settings := mysql.NewConfig()
+	settings.Net = "tcp"
+	settings.Addr = c.Address
+	settings.User = username
+	settings.Passwd = password
+	settings.DBName = options.Name
+	settings.Timeout = time.Duration(c.Timeout)
+	settings.TLS = config
+	connector, err := mysql.NewConnector(settings)
+	if err != nil {
+		return err
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	if err := db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&c.Result.Database.Version); err != nil {
+		return err
+	}
+	if options.Query != "" {
+		rows, err := db.QueryContext(ctx, options.Query)
+		if err != nil {
+			return fmt.Errorf("error running query: %w", err)
+		}
+		defer rows.Close()
+		// errors in the statement may only surface while reading its rows
+		for rows.Next() {
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error running query: %w", err)
+		}
+	}
+	return nil
+}
+
+// doRedis connects to a Redis server, sending the credentials only if they
+// are configured.
+func (c *Check) doRedis(ctx context.Context, options *DatabaseOptions, username, password string, authenticate bool, config *tls.Config) error {
+	opts := &redis.Options{
+		Addr:        c.Address,
+		DialTimeout: time.Duration(c.Timeout),
+		TLSConfig:   config,
+	}
+	if authenticate {
+		opts.Username = username
+		opts.Password = password
+	}
+	if options.Name != "" {
+		db, err := strconv.Atoi(options.Name)
+		if err != nil {
+			return fmt.Errorf("invalid database number '%s': %w", options.Name, err)
+		}
+		opts.DB = db
+	}
+	client := redis.NewClient(opts)
+	defer client.Close()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return err
+	}
+	if info, err := client.Info(ctx, "server").Result(); err == nil {
+		scanner := bufio.NewScanner(strings.NewReader(info))
+		for scanner.Scan() {
+			if version, ok := strings.CutPrefix(scanner.Text(), "redis_version:"); ok {
+				c.Result.Database.Version = strings.TrimSpace(version)
+			}
+		}
+	}
+	if options.Query != "" {
+		args := []any{}
+		for _, field := range strings.Fields(options.Query) {
+			args = append(args, field)
+		}
+		if err := client.Do(ctx, args...).Err(); err != nil {
+			return fmt.Errorf("error running command: %w", err)
+		}
+	}
+	return nil
+}
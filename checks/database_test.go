@@ -0,0 +1,309 @@
+package checks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// startTCPServer starts a TCP server handling each connection with the given
+// function.
+func startTCPServer(handler func(conn net.Conn)) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start TCP server: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handler(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+// servePostgres emulates a PostgreSQL server accepting user "admin" with
+// password "secret" and rejecting user "blocked" as per pg_hba.conf.
+func servePostgres(conn net.Conn) {
+	backend := pgproto3.NewBackend(conn, conn)
+	message, err := backend.ReceiveStartupMessage()
+	if err != nil {
+		return
+	}
+	startup, ok := message.(*pgproto3.StartupMessage)
+	if !ok {
+		return
+	}
+	if startup.Parameters["user"] == "blocked" {
+		backend.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28000", Message: "no pg_hba.conf entry for host"})
+		_ = backend.Flush()
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationCleartextPassword{})
+	_ = backend.Flush()
+	_ = backend.SetAuthType(pgproto3.AuthTypeCleartextPassword)
+	message, err = backend.Receive()
+	if err != nil {
+		return
+	}
+	if password, ok := message.(*pgproto3.PasswordMessage); !ok || startup.Parameters["user"] != "admin" || password.Password != "secret" {
+		backend.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28P01", Message: "password authentication failed"})
+		_ = backend.Flush()
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.ParameterStatus{Name: "server_version", Value: "16.2"})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: []byte{0, 0, 0, 1}})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	_ = backend.Flush()
+	for {
+		message, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch message := message.(type) {
+		case *pgproto3.Query:
+			if message.String == "SELECT 1" {
+				backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte("?column?"), DataTypeOID: 23, DataTypeSize: 4, TypeModifier: -1}}})
+				backend.Send(&pgproto3.DataRow{Values: [][]byte{[]byte("1")}})
+				backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")})
+			} else {
+				backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42601", Message: "syntax error"})
+			}
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			_ = backend.Flush()
+		case *pgproto3.Terminate:
+			return
+		}
+	}
+}
+
+// writeMySQLPacket writes a MySQL packet with the given sequence number.
+func writeMySQLPacket(conn net.Conn, sequence byte, payload []byte) {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), sequence}
+	_, _ = conn.Write(append(header, payload...))
+}
+
+// readMySQLPacket reads a MySQL packet, returning its payload.
+func readMySQLPacket(reader *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err := io.ReadFull(reader, payload)
+	return payload, err
+}
+
+// lengthEncoded returns the length-encoded MySQL string.
+func lengthEncoded(value string) []byte {
+	return append([]byte{byte(len(value))}, value...)
+}
+
+// serveMySQL emulates a MySQL server accepting user "admin" only; the host
+// "blocked" cannot connect at all, and the query "SELECT 1/0" fails while its
+// rows are being read.
+func serveMySQL(blocked bool) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		if blocked {
+			writeMySQLPacket(conn, 0, append([]byte{0xff, 0x6a, 0x04}, "Host is not allowed to connect to this MySQL server"...))
+			return
+		}
+		// protocol 41, secure connection, plugin auth, connect with DB, transactions
+		capabilities := uint32(0x1 | 0x8 | 0x200 | 0x2000 | 0x8000 | 0x80000)
+		greeting := []byte{0x0a}
+		greeting = append(greeting, "8.0.36\x00"...)
+		greeting = append(greeting, 1, 0, 0, 0)
+		greeting = append(greeting, "abcdefgh\x00"...)
+		greeting = binary.LittleEndian.AppendUint16(greeting, uint16(capabilities))
+		greeting = append(greeting, 0x21, 0x02, 0x00)
+		greeting = binary.LittleEndian.AppendUint16(greeting, uint16(capabilities>>16))
+		greeting = append(greeting, 21)
+		greeting = append(greeting, make([]byte, 10)...)
+		greeting = append(greeting, "ijklmnopqrst\x00"...)
+		greeting = append(greeting, "mysql_native_password\x00"...)
+		writeMySQLPacket(conn, 0, greeting)
+
+		reader := bufio.NewReader(conn)
+		response, err := readMySQLPacket(reader)
+		if err != nil || len(response) < 33 {
+			return
+		}
+		user, _, _ := bytes.Cut(response[32:], []byte{0})
+		if string(user) != "admin" {
+			writeMySQLPacket(conn, 2, append([]byte{0xff, 0x15, 0x04, '#'}, "28000Access denied for user"...))
+			return
+		}
+		writeMySQLPacket(conn, 2, []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})
+
+		eof := []byte{0xfe, 0x00, 0x00, 0x02, 0x00}
+		for {
+			command, err := readMySQLPacket(reader)
+			if err != nil || len(command) == 0 || command[0] == 0x01 {
+				return
+			}
+			query := string(command[1:])
+			value := map[string]string{"SELECT VERSION()": "8.0.36", "SELECT 1": "1", "SELECT 1/0": "1"}[query]
+			if value == "" {
+				writeMySQLPacket(conn, 1, append([]byte{0xff, 0x28, 0x04, '#'}, "42000You have an error in your SQL syntax"...))
+				continue
+			}
+			column := []byte{}
+			for _, field := range []string{"def", "", "", "", query, ""} {
+				column = append(column, lengthEncoded(field)...)
+			}
+			column = append(column, 0x0c, 0x21, 0x00, 0xff, 0x00, 0x00, 0x00, 0xfd, 0x00, 0x00, 0x00, 0x00, 0x00)
+			writeMySQLPacket(conn, 1, []byte{0x01})
+			writeMySQLPacket(conn, 2, column)
+			writeMySQLPacket(conn, 3, eof)
+			if query == "SELECT 1/0" {
+				writeMySQLPacket(conn, 4, append([]byte{0xff, 0x6b, 0x05, '#'}, "22003Division by zero"...))
+				continue
+			}
+			writeMySQLPacket(conn, 4, lengthEncoded(value))
+			writeMySQLPacket(conn, 5, eof)
+		}
+	}
+}
+
+// serveRedis emulates a Redis server with the given ACL user (or the default
+// user, if empty) and password, speaking RESP2 only.
+func serveRedis(username, password string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		authenticated := password == ""
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || !strings.HasPrefix(line, "*") {
+				return
+			}
+			count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			args := []string{}
+			for range count {
+				if _, err := reader.ReadString('\n'); err != nil {
+					return
+				}
+				arg, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				args = append(args, strings.TrimSpace(arg))
+			}
+			var reply string
+			switch command := strings.ToUpper(args[0]); {
+			case command == "AUTH":
+				if args[len(args)-1] == password && (username == "" || (len(args) == 3 && args[1] == username)) {
+					authenticated = true
+					reply = "+OK\r\n"
+				} else {
+					reply = "-WRONGPASS invalid username-password pair\r\n"
+				}
+			case command == "HELLO" || command == "CLIENT":
+				reply = fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+			case !authenticated:
+				reply = "-NOAUTH Authentication required.\r\n"
+			case command == "PING":
+				reply = "+PONG\r\n"
+			case command == "INFO":
+				info := "# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n"
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(info), info)
+			case command == "SELECT":
+				reply = "+OK\r\n"
+			default:
+				reply = fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+			}
+			if _, err := io.WriteString(conn, reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	postgres, stop := startTCPServer(servePostgres)
+	defer stop()
+	mysql, stop := startTCPServer(serveMySQL(false))
+	defer stop()
+	blocked, stop := startTCPServer(serveMySQL(true))
+	defer stop()
+	redis, stop := startTCPServer(serveRedis("", "secret"))
+	defer stop()
+	acl, stop := startTCPServer(serveRedis("netcheck", "secret"))
+	defer stop()
+	open, stop := startTCPServer(serveRedis("", ""))
+	defer stop()
+
+	t.Setenv("NETCHECK_TEST_DB_ADMIN", "admin")
+	t.Setenv("NETCHECK_TEST_DB_BLOCKED", "blocked")
+	t.Setenv("NETCHECK_TEST_DB_PASSWORD", "secret")
+	t.Setenv("NETCHECK_TEST_DB_WRONG", "wrong")
+	t.Setenv("NETCHECK_TEST_DB_NETCHECK", "netcheck")
+
+	admin := &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_ADMIN", PasswordEnv: "NETCHECK_TEST_DB_PASSWORD"}
+
+	tests := []struct {
+		address  string
+		protocol Protocol
+		options  *DatabaseOptions
+		failure  string
+		version  string
+	}{
+		{postgres, POSTGRES, admin, "", "16.2"},
+		{postgres, POSTGRES, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_ADMIN", PasswordEnv: "NETCHECK_TEST_DB_PASSWORD", Query: "SELECT 1"}, "", "16.2"},
+		{postgres, POSTGRES, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_ADMIN", PasswordEnv: "NETCHECK_TEST_DB_PASSWORD", Query: "SELEKT 1"}, "error running query", ""},
+		{postgres, POSTGRES, nil, "", ""},
+		{postgres, POSTGRES, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_ADMIN", PasswordEnv: "NETCHECK_TEST_DB_WRONG"}, "28P01", ""},
+		{postgres, POSTGRES, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_BLOCKED"}, "no pg_hba.conf entry", ""},
+		{postgres, POSTGRES, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_MISSING"}, "is not set", ""},
+		{mysql, MYSQL, admin, "", "8.0.36"},
+		{mysql, MYSQL, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_ADMIN", PasswordEnv: "NETCHECK_TEST_DB_PASSWORD", Query: "SELECT 1"}, "", "8.0.36"},
+		{mysql, MYSQL, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_ADMIN", PasswordEnv: "NETCHECK_TEST_DB_PASSWORD", Query: "SELEKT 1"}, "error running query", ""},
+		{mysql, MYSQL, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_ADMIN", PasswordEnv: "NETCHECK_TEST_DB_PASSWORD", Query: "SELECT 1/0"}, "Division by zero", ""},
+		{mysql, MYSQL, nil, "", ""},
+		{mysql, MYSQL, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_BLOCKED", PasswordEnv: "NETCHECK_TEST_DB_PASSWORD"}, "Access denied", ""},
+		{blocked, MYSQL, nil, "not allowed to connect", ""},
+		{redis, REDIS, &DatabaseOptions{PasswordEnv: "NETCHECK_TEST_DB_PASSWORD", Query: "PING"}, "", "7.2.4"},
+		{redis, REDIS, nil, "", ""},
+		{redis, REDIS, &DatabaseOptions{PasswordEnv: "NETCHECK_TEST_DB_WRONG"}, "WRONGPASS", ""},
+		{acl, REDIS, &DatabaseOptions{UsernameEnv: "NETCHECK_TEST_DB_NETCHECK", PasswordEnv: "NETCHECK_TEST_DB_PASSWORD"}, "", "7.2.4"},
+		{acl, REDIS, &DatabaseOptions{PasswordEnv: "NETCHECK_TEST_DB_PASSWORD"}, "WRONGPASS", ""},
+		{open, REDIS, &DatabaseOptions{Name: "2"}, "", "7.2.4"},
+		{open, REDIS, &DatabaseOptions{Query: "FLUSHALL"}, "error running command", ""},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  test.address,
+			Protocol: test.protocol,
+			Timeout:  Timeout(2 * time.Second),
+			Database: test.options,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		case test.failure == "" && check.Result.Database.Version != test.version:
+			log.Fatalf("Unexpected version in test %d: expected '%s', got '%s'", i, test.version, check.Result.Database.Version)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/dihedron/netcheck/pointer"
+	"github.com/dihedron/netcheck/tlsconfig"
 	"github.com/mitchellh/go-homedir"
 	"gopkg.in/yaml.v3"
 )
@@ -20,6 +21,7 @@ const (
 	DefaultPingCount    = 10
 	DefaultPingInterval = Timeout(100 * time.Millisecond)
 	DefaultPingSize     = 64
+	DefaultPingMode     = "auto"
 )
 
 type Defaults struct {
@@ -31,7 +33,9 @@ type Defaults struct {
 		Count    *int     `yaml:"count"`
 		Interval *Timeout `yaml:"interval"`
 		Size     *int     `yaml:"size"`
+		Mode     *string  `yaml:"mode"`
 	} `yaml:"ping"`
+	TLS *tlsconfig.Options `yaml:"tls"` // TLS settings for fetching remote bundles
 }
 
 var Default *Defaults
@@ -80,6 +84,7 @@ func loadDefaultsFrom(path string) error {
 			Count    *int     `yaml:"count"`
 			Interval *Timeout `yaml:"interval"`
 			Size     *int     `yaml:"size"`
+			Mode     *string  `yaml:"mode"`
 		}{}
 	}
 	if Default.Ping.Count == nil {
@@ -91,5 +96,8 @@ func loadDefaultsFrom(path string) error {
 	if Default.Ping.Size == nil {
 		Default.Ping.Size = pointer.To(DefaultPingSize)
 	}
+	if Default.Ping.Mode == nil {
+		Default.Ping.Mode = pointer.To(DefaultPingMode)
+	}
 	return nil
 }
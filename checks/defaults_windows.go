@@ -29,10 +29,12 @@ func init() {
 				Count    *int     `yaml:"count"`
 				Interval *Timeout `yaml:"interval"`
 				Size     *int     `yaml:"size"`
+				Mode     *string  `yaml:"mode"`
 			}{
 				pointer.To(DefaultPingCount),
 				pointer.To(DefaultPingInterval),
 				pointer.To(DefaultPingSize),
+				pointer.To(DefaultPingMode),
 			},
 		}
 	}
@@ -0,0 +1,179 @@
+package checks
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSQuery contains the parameters of a DNS check: the check's Address is the
+// address of the DNS server (resolver) to query, whereas the name to resolve
+// and the type of record to ask for are provided here.
+type DNSQuery struct {
+	// Name is the name to resolve; for PTR queries it can be an IP address,
+	// which is automatically converted into its reverse lookup name.
+	Name string `json:"name" yaml:"name"`
+	// Type is the type of record to query for, one of A (the default), AAAA,
+	// CNAME, MX, SRV, TXT and PTR.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Transport is the transport protocol used to query the DNS server, one
+	// of "udp" (the default) and "tcp".
+	Transport string `json:"transport,omitempty" yaml:"transport,omitempty"`
+	// Expect contains the optional assertions on the answers.
+	Expect *DNSExpect `json:"expect,omitempty" yaml:"expect,omitempty"`
+}
+
+// DNSExpect contains the assertions to verify on the answers returned by the
+// DNS server.
+type DNSExpect struct {
+	// Contains lists the values (e.g. IP addresses) that must all be present
+	// among the answers.
+	Contains []string `json:"contains,omitempty" yaml:"contains,omitempty"`
+	// Matches is a regular expression that at least one answer must match.
+	Matches string `json:"matches,omitempty" yaml:"matches,omitempty"`
+	// MinAnswers is the minimum number of answers expected.
+	MinAnswers int `json:"min_answers,omitempty" yaml:"min_answers,omitempty"`
+}
+
+// DNSResult contains the outcome of a DNS check.
+type DNSResult struct {
+	// Answers is the list of answers, in textual format.
+	Answers []string `json:"answers,omitempty" yaml:"answers,omitempty"`
+	// RTT is the round trip time to the resolver.
+	RTT Timeout `json:"rtt" yaml:"rtt"`
+}
+
+// doDNS queries the DNS server at the check's address for the given name and
+// record type, then verifies the optional assertions on the answers.
+func (c *Check) doDNS() error {
+	if c.DNS == nil || c.DNS.Name == "" {
+		slog.Error("no name to resolve in DNS check", "address", c.Address)
+		return fmt.Errorf("no name to resolve in DNS check against %s", c.Address)
+	}
+
+	rtype := strings.ToUpper(c.DNS.Type)
+	if rtype == "" {
+		rtype = "A"
+	}
+	qtype, ok := dns.StringToType[rtype]
+	switch qtype {
+	case dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeMX, dns.TypeSRV, dns.TypeTXT, dns.TypePTR:
+	default:
+		ok = false
+	}
+	if !ok {
+		slog.Error("unsupported DNS record type", "type", c.DNS.Type)
+		return fmt.Errorf("unsupported DNS record type: '%s'", c.DNS.Type)
+	}
+
+	name := c.DNS.Name
+	if qtype == dns.TypePTR && net.ParseIP(name) != nil {
+		var err error
+		if name, err = dns.ReverseAddr(name); err != nil {
+			slog.Error("error computing reverse address", "name", c.DNS.Name, "error", err)
+			return fmt.Errorf("error computing reverse address of %s: %w", c.DNS.Name, err)
+		}
+	}
+
+	transport := strings.ToLower(c.DNS.Transport)
+	switch transport {
+	case "":
+		transport = "udp"
+	case "udp", "tcp":
+	default:
+		slog.Error("unsupported DNS transport", "transport", c.DNS.Transport)
+		return fmt.Errorf("unsupported DNS transport: '%s'", c.DNS.Transport)
+	}
+
+	address := c.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "53")
+	}
+
+	client := &dns.Client{
+		Net:     transport,
+		Timeout: time.Duration(c.Timeout),
+	}
+	query := &dns.Msg{}
+	query.SetQuestion(dns.Fqdn(name), qtype)
+
+	slog.Debug("querying DNS server", "address", address, "transport", transport, "name", name, "type", dns.TypeToString[qtype])
+	response, rtt, err := client.Exchange(query, address)
+	if err != nil {
+		slog.Error("error querying DNS server", "address", address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error querying DNS server %s for %s: %w", address, c.DNS.Name, err)
+	}
+
+	c.Result.DNS = &DNSResult{
+		RTT: Timeout(rtt),
+	}
+
+	if response.Rcode != dns.RcodeSuccess {
+		slog.Error("DNS server returned an error", "address", address, "name", name, "rcode", dns.RcodeToString[response.Rcode])
+		return withClass(ClassDNS, fmt.Errorf("DNS server %s returned %s for %s", address, dns.RcodeToString[response.Rcode], c.DNS.Name))
+	}
+
+	for _, rr := range response.Answer {
+		if rr.Header().Rrtype != qtype {
+			// e.g. the CNAME records leading to the A record
+			continue
+		}
+		switch rr := rr.(type) {
+		case *dns.A:
+			c.Result.DNS.Answers = append(c.Result.DNS.Answers, rr.A.String())
+		case *dns.AAAA:
+			c.Result.DNS.Answers = append(c.Result.DNS.Answers, rr.AAAA.String())
+		case *dns.CNAME:
+			c.Result.DNS.Answers = append(c.Result.DNS.Answers, rr.Target)
+		case *dns.MX:
+			c.Result.DNS.Answers = append(c.Result.DNS.Answers, fmt.Sprintf("%d %s", rr.Preference, rr.Mx))
+		case *dns.SRV:
+			c.Result.DNS.Answers = append(c.Result.DNS.Answers, fmt.Sprintf("%d %d %d %s", rr.Priority, rr.Weight, rr.Port, rr.Target))
+		case *dns.TXT:
+			c.Result.DNS.Answers = append(c.Result.DNS.Answers, strings.Join(rr.Txt, ""))
+		case *dns.PTR:
+			c.Result.DNS.Answers = append(c.Result.DNS.Answers, rr.Ptr)
+		}
+	}
+
+	slog.Debug("DNS answers received", "address", address, "name", name, "answers", c.Result.DNS.Answers, "rtt", rtt)
+
+	if expect := c.DNS.Expect; expect != nil {
+		if len(c.Result.DNS.Answers) < expect.MinAnswers {
+			slog.Error("too few DNS answers", "name", name, "expected", expect.MinAnswers, "actual", len(c.Result.DNS.Answers))
+			return withClass(ClassAssertionFailed, fmt.Errorf("DNS server %s returned %d answers for %s, expected at least %d", address, len(c.Result.DNS.Answers), c.DNS.Name, expect.MinAnswers))
+		}
+		for _, value := range expect.Contains {
+			found := slices.ContainsFunc(c.Result.DNS.Answers, func(answer string) bool {
+				if ip := net.ParseIP(value); ip != nil {
+					return ip.Equal(net.ParseIP(answer))
+				}
+				return strings.EqualFold(dns.Fqdn(answer), dns.Fqdn(value))
+			})
+			if !found {
+				slog.Error("expected value not among DNS answers", "name", name, "expected", value, "answers", c.Result.DNS.Answers)
+				return withClass(ClassAssertionFailed, fmt.Errorf("DNS server %s did not return %s for %s", address, value, c.DNS.Name))
+			}
+		}
+		if expect.Matches != "" {
+			re, err := regexp.Compile(expect.Matches)
+			if err != nil {
+				slog.Error("invalid regular expression", "pattern", expect.Matches, "error", err)
+				return fmt.Errorf("invalid regular expression '%s': %w", expect.Matches, err)
+			}
+			if !slices.ContainsFunc(c.Result.DNS.Answers, re.MatchString) {
+				slog.Error("no DNS answer matches the pattern", "name", name, "pattern", expect.Matches, "answers", c.Result.DNS.Answers)
+				return withClass(ClassAssertionFailed, fmt.Errorf("no answer from DNS server %s for %s matches '%s'", address, c.DNS.Name, expect.Matches))
+			}
+		}
+	}
+
+	slog.Info("successfully tested connection", "address", address, "protocol", c.Protocol.String(), "name", name, "answers", c.Result.DNS.Answers, "rtt", rtt)
+	return nil
+}
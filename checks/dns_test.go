@@ -0,0 +1,111 @@
+package checks
+
+import (
+	"log"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startDNSServer starts a local DNS server on the given network, answering
+// for a handful of records under example.com.
+func startDNSServer(network string) (string, func()) {
+	mux := dns.NewServeMux()
+	mux.HandleFunc("example.com.", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := &dns.Msg{}
+		m.SetReply(r)
+		q := r.Question[0]
+		switch {
+		case q.Name == "www.example.com." && q.Qtype == dns.TypeA:
+			rr1, _ := dns.NewRR("www.example.com. 60 IN A 192.0.2.1")
+			rr2, _ := dns.NewRR("www.example.com. 60 IN A 192.0.2.2")
+			m.Answer = append(m.Answer, rr1, rr2)
+		case q.Name == "example.com." && q.Qtype == dns.TypeMX:
+			rr, _ := dns.NewRR("example.com. 60 IN MX 10 mail.example.com.")
+			m.Answer = append(m.Answer, rr)
+		case q.Name == "example.com." && q.Qtype == dns.TypeTXT:
+			rr, _ := dns.NewRR(`example.com. 60 IN TXT "v=spf1 -all"`)
+			m.Answer = append(m.Answer, rr)
+		default:
+			m.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(m)
+	})
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		Net:               network,
+		Handler:           mux,
+		NotifyStartedFunc: func() { close(started) },
+	}
+	var address string
+	switch network {
+	case "udp":
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			log.Fatalf("error opening UDP socket: %v", err)
+		}
+		server.PacketConn = conn
+		address = conn.LocalAddr().String()
+	case "tcp":
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			log.Fatalf("error opening TCP socket: %v", err)
+		}
+		server.Listener = listener
+		address = listener.Addr().String()
+	}
+	go func() {
+		if err := server.ActivateAndServe(); err != nil {
+			slog.Debug("DNS server exiting", "error", err)
+		}
+	}()
+	<-started
+	return address, func() { _ = server.Shutdown() }
+}
+
+func TestDNS(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		address, stop := startDNSServer(network)
+		defer stop()
+
+		tests := []struct {
+			query   DNSQuery
+			success bool
+			answers int
+		}{
+			{DNSQuery{Name: "www.example.com"}, true, 2},
+			{DNSQuery{Name: "www.example.com", Expect: &DNSExpect{Contains: []string{"192.0.2.2"}, MinAnswers: 2}}, true, 2},
+			{DNSQuery{Name: "www.example.com", Expect: &DNSExpect{Contains: []string{"192.0.2.3"}}}, false, 2},
+			{DNSQuery{Name: "www.example.com", Expect: &DNSExpect{MinAnswers: 3}}, false, 2},
+			{DNSQuery{Name: "example.com", Type: "mx", Expect: &DNSExpect{Matches: `^10 mail\.`}}, true, 1},
+			{DNSQuery{Name: "example.com", Type: "TXT", Expect: &DNSExpect{Matches: `^v=spf2`}}, false, 1},
+			{DNSQuery{Name: "missing.example.com"}, false, 0},
+			{DNSQuery{Name: "www.example.com", Type: "NS"}, false, 0},
+		}
+
+		for _, test := range tests {
+			test.query.Transport = network
+			check := &Check{
+				Address:  address,
+				Protocol: DNS,
+				Timeout:  Timeout(2 * time.Second),
+				DNS:      &test.query,
+			}
+			err := check.Do()
+			if test.success != (err == nil) {
+				log.Fatalf("Unexpected result querying %s for %s over %s: %v", test.query.Type, test.query.Name, network, err)
+			}
+			if test.answers > 0 && (check.Result.DNS == nil || len(check.Result.DNS.Answers) != test.answers) {
+				log.Fatalf("Unexpected answers for %s over %s: %v", test.query.Name, network, check.Result.DNS)
+			}
+			if err != nil && !strings.Contains(err.Error(), test.query.Name) && test.query.Type != "NS" {
+				log.Fatalf("Error does not mention the queried name: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package checks
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+	"github.com/pion/dtls/v3"
+)
+
+// DTLSOptions contains the settings specific to DTLS checks; certificates,
+// trust anchors and server name are taken from the TLS options.
+type DTLSOptions struct {
+	// PSKIdentity is the identity sent to the server in pre-shared key mode.
+	PSKIdentity string `json:"psk_identity,omitempty" yaml:"psk_identity,omitempty"`
+	// PSKEnv is the name of the variable holding the hex encoded pre-shared
+	// key; when set, the handshake uses the PSK cipher suites instead of
+	// certificates.
+	PSKEnv string `json:"psk_env,omitempty" yaml:"psk_env,omitempty"`
+}
+
+// doDTLS performs a DTLS 1.2 handshake with the check's address, including
+// the cookie exchange if requested by the server, then verifies the hostname
+// and the expiry of the certificate as for TLS.
+func (c *Check) doDTLS() error {
+	config, err := tlsconfig.New(c.TLS, hostname(c.Address))
+	if err != nil {
+		slog.Error("error preparing TLS configuration", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error preparing TLS configuration for %s: %w", c.Address, err)
+	}
+
+	options := &dtls.Config{
+		Certificates:         config.Certificates,
+		RootCAs:              config.RootCAs,
+		ServerName:           config.ServerName,
+		InsecureSkipVerify:   config.InsecureSkipVerify, // #nosec G402
+		ExtendedMasterSecret: dtls.RequestExtendedMasterSecret,
+	}
+	if c.DTLS != nil && c.DTLS.PSKEnv != "" {
+		value, ok := os.LookupEnv(c.DTLS.PSKEnv)
+		if !ok {
+			return fmt.Errorf("environment variable '%s' with pre-shared key is not set", c.DTLS.PSKEnv)
+		}
+		key, err := hex.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("invalid pre-shared key in environment variable '%s': %w", c.DTLS.PSKEnv, err)
+		}
+		options.PSK = func([]byte) ([]byte, error) { return key, nil }
+		options.PSKIdentityHint = []byte(c.DTLS.PSKIdentity)
+		options.CipherSuites = []dtls.CipherSuiteID{
+			dtls.TLS_PSK_WITH_AES_128_GCM_SHA256,
+			dtls.TLS_PSK_WITH_AES_128_CCM,
+			dtls.TLS_PSK_WITH_AES_128_CCM_8,
+			dtls.TLS_PSK_WITH_AES_256_CCM_8,
+			dtls.TLS_PSK_WITH_AES_128_CBC_SHA256,
+		}
+	}
+
+	address, err := net.ResolveUDPAddr("udp", c.Address)
+	if err != nil {
+		slog.Error("error resolving address", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error resolving %s: %w", c.Address, err)
+	}
+	conn, err := dtls.Dial("udp", address, options)
+	if err != nil {
+		slog.Error("error dialling", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error dialling %s on protocol %s: %w", c.Address, c.Protocol.String(), err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.Timeout))
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		slog.Error("error performing DTLS handshake", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error performing DTLS handshake with %s: %w", c.Address, err)
+	}
+
+	state, _ := conn.ConnectionState()
+	chain := []*x509.Certificate{}
+	for _, data := range state.PeerCertificates {
+		certificate, err := x509.ParseCertificate(data)
+		if err != nil {
+			slog.Error("error parsing server certificate", "address", c.Address, "error", err)
+			return fmt.Errorf("error parsing certificate from host %s: %w", c.Address, err)
+		}
+		chain = append(chain, certificate)
+	}
+	c.Result.TLS = &TLSResult{
+		Version:     "DTLS 1.2",
+		CipherSuite: dtls.CipherSuiteName(state.CipherSuiteID),
+	}
+	for _, certificate := range chain {
+		c.Result.TLS.Certificates = append(c.Result.TLS.Certificates, newCertificate(certificate))
+	}
+	return c.verifyPeer(chain, config)
+}
@@ -0,0 +1,139 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+	"github.com/pion/dtls/v3"
+)
+
+// startDTLSServer starts a DTLS server with the given configuration, which
+// accepts connections and closes them right after the handshake.
+func startDTLSServer(config *dtls.Config) (string, func()) {
+	listener, err := dtls.Listen("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")}, config)
+	if err != nil {
+		log.Fatalf("Could not start DTLS server: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				defer cancel()
+				_ = conn.(*dtls.Conn).HandshakeContext(ctx)
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+// the server requests the cookie exchange (HelloVerifyRequest) by default
+func TestDTLSCertificate(t *testing.T) {
+	ca := newTestCA("Test Root CA")
+	server := newTestServerCertificate(ca, time.Now().Add(10*24*time.Hour))
+	pair, err := tls.X509KeyPair([]byte(server.CertPEM), []byte(server.KeyPEM))
+	if err != nil {
+		log.Fatalf("Could not load server key pair: %v", err)
+	}
+	address, stop := startDTLSServer(&dtls.Config{
+		Certificates:         []tls.Certificate{pair},
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	})
+	defer stop()
+
+	tests := []struct {
+		options *tlsconfig.Options
+		warning Timeout
+		status  Status
+		failure string
+	}{
+		{&tlsconfig.Options{CA: ca.CertPEM}, 0, Success, ""},
+		{&tlsconfig.Options{CA: ca.CertPEM, ServerName: "server.example.com"}, 0, Success, ""},
+		{&tlsconfig.Options{CA: ca.CertPEM}, Timeout(30 * 24 * time.Hour), Warning, "CN=localhost"},
+		{&tlsconfig.Options{Insecure: true}, 0, Success, ""},
+		{nil, 0, Failure, "certificate signed by unknown authority"},
+		{&tlsconfig.Options{CA: ca.CertPEM, ServerName: "other.example.com"}, 0, Failure, "other.example.com"},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:       address,
+			Protocol:      DTLS,
+			Timeout:       Timeout(2 * time.Second),
+			TLS:           test.options,
+			ExpiryWarning: test.warning,
+		}
+		check.Result.err = check.Do()
+		if check.Result.Status() != test.status {
+			log.Fatalf("Unexpected status in test %d: expected %v, got %v (%s)", i, test.status, check.Result.Status(), check.Result.String())
+		}
+		if test.failure != "" && !strings.Contains(check.Result.String(), test.failure) {
+			log.Fatalf("Unexpected result in test %d: expected '%s', got '%s'", i, test.failure, check.Result.String())
+		}
+		if test.status != Failure {
+			if check.Result.TLS == nil || check.Result.TLS.Version != "DTLS 1.2" || len(check.Result.TLS.Certificates) != 1 {
+				log.Fatalf("Unexpected DTLS details in test %d: %+v", i, check.Result.TLS)
+			}
+		}
+	}
+}
+
+func TestDTLSPreSharedKey(t *testing.T) {
+	address, stop := startDTLSServer(&dtls.Config{
+		PSK: func(identity []byte) ([]byte, error) {
+			if string(identity) != "netcheck" {
+				return nil, errors.New("unknown identity")
+			}
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("server"),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+	})
+	defer stop()
+
+	t.Setenv("NETCHECK_TEST_PSK", "abc123")
+	t.Setenv("NETCHECK_TEST_WRONG_PSK", "123abc")
+	t.Setenv("NETCHECK_TEST_INVALID_PSK", "not hex")
+
+	tests := []struct {
+		options *DTLSOptions
+		failure string
+	}{
+		{&DTLSOptions{PSKIdentity: "netcheck", PSKEnv: "NETCHECK_TEST_PSK"}, ""},
+		{&DTLSOptions{PSKIdentity: "netcheck", PSKEnv: "NETCHECK_TEST_WRONG_PSK"}, "handshake"},
+		{&DTLSOptions{PSKIdentity: "other", PSKEnv: "NETCHECK_TEST_PSK"}, "handshake"},
+		{&DTLSOptions{PSKIdentity: "netcheck", PSKEnv: "NETCHECK_TEST_INVALID_PSK"}, "invalid pre-shared key"},
+		{&DTLSOptions{PSKIdentity: "netcheck", PSKEnv: "NETCHECK_TEST_MISSING_PSK"}, "is not set"},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  address,
+			Protocol: DTLS,
+			Timeout:  Timeout(2 * time.Second),
+			DTLS:     test.options,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		case test.failure == "" && check.Result.TLS.CipherSuite != "TLS_PSK_WITH_AES_128_CCM_8":
+			log.Fatalf("Unexpected cipher suite in test %d: %s", i, check.Result.TLS.CipherSuite)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+)
+
+// Layer is a layer of the network stack in the diagnosis of a failed check.
+type Layer string
+
+const (
+	LayerDNS         Layer = "dns"
+	LayerICMP        Layer = "icmp"
+	LayerTCP         Layer = "tcp"
+	LayerTLS         Layer = "tls"
+	LayerApplication Layer = "application"
+)
+
+// Explanation contains the diagnosis of a failed check, obtained by testing
+// each layer of the network stack bottom up: name resolution, reachability
+// over ICMP, TCP connection, TLS handshake and application protocol.
+type Explanation struct {
+	// Layer is the first layer that failed.
+	Layer Layer `json:"layer" yaml:"layer"`
+	// Steps lists the outcome of each layer tested.
+	Steps []Step `json:"steps" yaml:"steps"`
+}
+
+// Step is the outcome of the test of a layer in a diagnosis.
+type Step struct {
+	// Layer is the layer tested.
+	Layer Layer `json:"layer" yaml:"layer"`
+	// OK is whether the layer works.
+	OK bool `json:"ok" yaml:"ok"`
+	// Detail describes what was found (e.g. the resolved addresses) or why
+	// the layer failed.
+	Detail string `json:"detail" yaml:"detail"`
+}
+
+// String returns a one-line representation of the step.
+func (s Step) String() string {
+	outcome := "ok"
+	if !s.OK {
+		outcome = "failed"
+	}
+	return fmt.Sprintf("%-11s %-6s %s", s.Layer, outcome, s.Detail)
+}
+
+// explain diagnoses the failure of the check, whose error is given, testing
+// the layers below the application protocol one at a time; layers not used by
+// the check's protocol (e.g. TLS in plain HTTP checks) are skipped.
+func (c *Check) explain(failure error) *Explanation {
+	host, port := c.endpoint()
+	if port == 0 && c.Protocol == DNS {
+		port = 53
+	}
+	explanation := &Explanation{}
+	step := func(layer Layer, detail string, err error) bool {
+		if err != nil {
+			explanation.Steps = append(explanation.Steps, Step{Layer: layer, Detail: err.Error()})
+			if explanation.Layer == "" {
+				explanation.Layer = layer
+			}
+			return false
+		}
+		explanation.Steps = append(explanation.Steps, Step{Layer: layer, OK: true, Detail: detail})
+		return true
+	}
+
+	// name resolution, bounded by the check's timeout; in DNS checks the host
+	// is the DNS server, whose answer to the query is the application layer
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(c.Timeout))
+		defer cancel()
+	}
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	detail := strings.Join(addresses, ", ")
+	if c.Protocol == DNS {
+		name := ""
+		if c.DNS != nil {
+			name = c.DNS.Name
+		}
+		if err != nil {
+			err = fmt.Errorf("error resolving DNS server %s (not the queried name '%s'): %w", host, name, err)
+		}
+		detail = fmt.Sprintf("DNS server %s resolved to %s (not the queried name '%s')", host, detail, name)
+	}
+	if !step(LayerDNS, detail, err) {
+		return explanation
+	}
+
+	if c.Protocol == ICMP {
+		step(LayerICMP, "", failure)
+		return explanation
+	}
+
+	// reachability, which is not conclusive as ICMP is often filtered
+	reachable, detail, err := c.explainICMP(host)
+	if err != nil {
+		// unknown, e.g. ICMP sockets are not available
+		reachable, detail = true, "not tested: "+err.Error()
+	}
+	explanation.Steps = append(explanation.Steps, Step{Layer: LayerICMP, OK: reachable && err == nil, Detail: detail})
+
+	switch c.Protocol {
+	case TCP, TLS, SSH, HTTP, HTTPS, BANNER, POSTGRES, MYSQL, REDIS, GRPC, GRPCS:
+		address := net.JoinHostPort(host, strconv.Itoa(port))
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", address, time.Duration(c.Timeout))
+		if err != nil {
+			if !reachable {
+				// the host does not answer at all
+				explanation.Layer = LayerICMP
+			}
+			step(LayerTCP, "", explainDial(address, err))
+			return explanation
+		}
+		conn.Close()
+		step(LayerTCP, fmt.Sprintf("connected to %s in %s", address, time.Since(start).Round(time.Microsecond)), nil)
+
+		if c.Protocol == TLS || c.Protocol == HTTPS || c.Protocol == GRPCS {
+			detail, err := c.explainTLS(address, host)
+			if !step(LayerTLS, detail, err) {
+				return explanation
+			}
+		}
+	case MTU, TRACEROUTE:
+		if !reachable {
+			explanation.Layer = LayerICMP
+			return explanation
+		}
+	}
+
+	step(LayerApplication, "", failure)
+	return explanation
+}
+
+// explainICMP pings the host, returning whether it replied and a description
+// of the outcome.
+func (c *Check) explainICMP(host string) (bool, string, error) {
+	options := c.pingOptions()
+	pinger, err := c.newPinger(host, options)
+	if err != nil {
+		return false, "", err
+	}
+	pinger.Count = 3
+	pinger.Timeout = time.Duration(DefaultPingTimeout)
+	if err := pinger.Run(); err != nil {
+		return false, "", err
+	}
+	stats := pinger.Statistics()
+	if stats.PacketsRecv == 0 {
+		return false, "no echo reply (host down, unreachable or filtering ICMP)", nil
+	}
+	return true, fmt.Sprintf("%d/%d echo replies, average round trip time %s", stats.PacketsRecv, stats.PacketsSent, stats.AvgRtt.Round(time.Microsecond)), nil
+}
+
+// explainDial describes the failure of a TCP connection.
+func explainDial(address string, err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Errorf("connection to %s refused (no service listening, or rejected by a firewall): %w", address, err)
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return fmt.Errorf("no route to %s (routing problem): %w", address, err)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("no response from %s (packets dropped by a firewall, or host down): %w", address, err)
+	}
+	return err
+}
+
+// explainTLS performs the TLS handshake with the given address, returning a
+// description of the negotiated session.
+func (c *Check) explainTLS(address string, host string) (string, error) {
+	options := tlsconfig.Options{}
+	if c.TLS != nil {
+		options = *c.TLS
+	}
+	if c.HTTP != nil && c.HTTP.Insecure {
+		options.Insecure = true
+	}
+	config, err := tlsconfig.New(&options, host)
+	if err != nil {
+		return "", err
+	}
+	conn, err := c.dialTLS(context.Background(), address, config, nil)
+	if err != nil {
+		slog.Debug("TLS handshake failed", "address", address, "error", err)
+		return "", err
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	detail := fmt.Sprintf("%s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	if len(state.PeerCertificates) > 0 {
+		detail += ", certificate " + state.PeerCertificates[0].Subject.String()
+	}
+	return detail, nil
+}
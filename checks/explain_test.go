@@ -0,0 +1,75 @@
+package checks
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+)
+
+func TestExplain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	ca := newTestCA("Test Root CA")
+	secure, stop := startTLSServer(serverConfig(newTestServerCertificate(ca, time.Time{})))
+	defer stop()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start TCP server: %v", err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		check  *Check
+		layer  Layer
+		detail string
+	}{
+		{&Check{Address: closed.Addr().String(), Protocol: TCP}, LayerTCP, "refused"},
+		{&Check{Address: "netcheck.invalid:80", Protocol: TCP}, LayerDNS, "netcheck.invalid"},
+		{&Check{Address: secure, Protocol: TLS}, LayerTLS, "certificate signed by unknown authority"},
+		{&Check{Address: secure, Protocol: TLS, TLS: &tlsconfig.Options{CA: ca.CertPEM}, Certificate: &CertificateExpect{IssuerCN: "Other CA"}}, LayerApplication, "Other CA"},
+		{&Check{Address: strings.TrimPrefix(server.URL, "http://"), Protocol: HTTP}, LayerApplication, "503"},
+	}
+
+	for i, test := range tests {
+		test.check.Timeout = Timeout(2 * time.Second)
+		err := test.check.Do()
+		if err == nil {
+			log.Fatalf("Expected error in test %d, got none", i)
+		}
+		explanation := test.check.explain(err)
+		if explanation.Layer != test.layer {
+			log.Fatalf("Unexpected layer in test %d: expected %s, got %+v", i, test.layer, explanation)
+		}
+		last := explanation.Steps[len(explanation.Steps)-1]
+		if last.Layer != test.layer || last.OK || !strings.Contains(last.Detail, test.detail) {
+			log.Fatalf("Unexpected last step in test %d: %+v", i, last)
+		}
+		for _, step := range explanation.Steps[:len(explanation.Steps)-1] {
+			if step.Layer != LayerICMP && !step.OK {
+				log.Fatalf("Unexpected failed step in test %d: %+v", i, step)
+			}
+		}
+	}
+
+	// DNS checks resolve the DNS server, not the queried name
+	explanation := (&Check{Address: "localhost:53", Protocol: DNS, Timeout: Timeout(2 * time.Second), DNS: &DNSQuery{Name: "www.example.com"}}).explain(errors.New("NXDOMAIN"))
+	if first := explanation.Steps[0]; explanation.Layer != LayerApplication || first.Layer != LayerDNS || !first.OK ||
+		!strings.Contains(first.Detail, "DNS server localhost") || !strings.Contains(first.Detail, "not the queried name 'www.example.com'") {
+		log.Fatalf("Unexpected explanation for DNS check: %+v", explanation)
+	}
+
+	// ICMP checks fail at the ICMP layer
+	explanation = (&Check{Address: "127.0.0.1", Protocol: ICMP}).explain(errors.New("no echo reply received"))
+	if explanation.Layer != LayerICMP || len(explanation.Steps) != 2 {
+		log.Fatalf("Unexpected explanation for ICMP check: %+v", explanation)
+	}
+}
@@ -0,0 +1,80 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+// GRPCOptions contains the settings of gRPC health checks.
+type GRPCOptions struct {
+	// Service is the name of the service whose health is checked; if empty,
+	// the overall health of the server is checked.
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+}
+
+// GRPCResult contains the outcome of a gRPC health check.
+type GRPCResult struct {
+	// Status is the serving status reported by the server.
+	Status string `json:"status" yaml:"status"`
+}
+
+// doGRPC calls the standard health service (grpc.health.v1.Health/Check) on
+// the check's address, over TLS for the grpcs protocol, and fails unless the
+// service is reported as serving.
+func (c *Check) doGRPC() error {
+	var service string
+	if c.GRPC != nil {
+		service = c.GRPC.Service
+	}
+
+	creds := insecure.NewCredentials()
+	var config *tls.Config
+	if c.Protocol == GRPCS {
+		var err error
+		config, err = tlsconfig.New(c.TLS, hostname(c.Address))
+		if err != nil {
+			slog.Error("error preparing TLS configuration", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+			return fmt.Errorf("error preparing TLS configuration for %s: %w", c.Address, err)
+		}
+		creds = credentials.NewTLS(config)
+	}
+
+	conn, err := grpc.NewClient(c.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		slog.Error("error creating gRPC client", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error creating gRPC client for %s: %w", c.Address, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.Timeout))
+	defer cancel()
+	var remote peer.Peer
+	response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service}, grpc.Peer(&remote))
+	if info, ok := remote.AuthInfo.(credentials.TLSInfo); ok {
+		c.Result.TLS = newTLSResult(info.State)
+	}
+	if err != nil {
+		slog.Error("error calling gRPC health service", "address", c.Address, "service", service, "error", err)
+		return fmt.Errorf("error calling health service on %s: %w", c.Address, err)
+	}
+	c.Result.GRPC = &GRPCResult{Status: response.GetStatus().String()}
+	if response.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		slog.Error("service not serving", "address", c.Address, "service", service, "status", response.GetStatus().String())
+		return withClass(ClassAssertionFailed, fmt.Errorf("service '%s' on %s is %s", service, c.Address, response.GetStatus().String()))
+	}
+	if info, ok := remote.AuthInfo.(credentials.TLSInfo); ok {
+		return c.verifyPeer(verifiedChain(info.State), config)
+	}
+	slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "service", service)
+	return nil
+}
@@ -0,0 +1,86 @@
+package checks
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startGRPCServer starts a gRPC server exposing the standard health service,
+// over TLS if a configuration is given.
+func startGRPCServer(config *tls.Config) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start gRPC server: %v", err)
+	}
+	options := []grpc.ServerOption{}
+	if config != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(config)))
+	}
+	server := grpc.NewServer(options...)
+	status := health.NewServer()
+	status.SetServingStatus("orders", healthpb.HealthCheckResponse_SERVING)
+	status.SetServingStatus("payments", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, status)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return listener.Addr().String(), server.Stop
+}
+
+func TestGRPC(t *testing.T) {
+	ca := newTestCA("Test Root CA")
+	plaintext, stop := startGRPCServer(nil)
+	defer stop()
+	secure, stop := startGRPCServer(serverConfig(newTestServerCertificate(ca, time.Time{})))
+	defer stop()
+
+	tests := []struct {
+		address  string
+		protocol Protocol
+		service  string
+		options  *tlsconfig.Options
+		failure  string
+	}{
+		{plaintext, GRPC, "", nil, ""},
+		{plaintext, GRPC, "orders", nil, ""},
+		{plaintext, GRPC, "payments", nil, "is NOT_SERVING"},
+		{plaintext, GRPC, "unknown", nil, "NotFound"},
+		{secure, GRPCS, "orders", &tlsconfig.Options{CA: ca.CertPEM}, ""},
+		{secure, GRPCS, "orders", nil, "certificate signed by unknown authority"},
+		{secure, GRPCS, "orders", &tlsconfig.Options{CA: ca.CertPEM, ServerName: "other.example.com"}, "other.example.com"},
+		{plaintext, GRPCS, "orders", &tlsconfig.Options{CA: ca.CertPEM}, "error calling health service"},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  test.address,
+			Protocol: test.protocol,
+			Timeout:  Timeout(2 * time.Second),
+			TLS:      test.options,
+			GRPC:     &GRPCOptions{Service: test.service},
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		case test.failure == "" && check.Result.GRPC.Status != "SERVING":
+			log.Fatalf("Unexpected status in test %d: %s", i, check.Result.GRPC.Status)
+		case test.failure == "" && test.protocol == GRPCS && (check.Result.TLS == nil || len(check.Result.TLS.Certificates) == 0):
+			log.Fatalf("TLS details not recorded in test %d", i)
+		}
+	}
+}
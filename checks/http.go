@@ -0,0 +1,395 @@
+package checks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultHTTPMaxBodySize is the maximum number of bytes read from the body of
+	// an HTTP response when evaluating assertions, unless otherwise specified.
+	DefaultHTTPMaxBodySize = 1024 * 1024
+	// DefaultHTTPMaxRedirects is the maximum number of redirects followed by an
+	// HTTP check, unless otherwise specified.
+	DefaultHTTPMaxRedirects = 10
+)
+
+// HTTPRequest contains the parameters of an HTTP(s) check.
+type HTTPRequest struct {
+	// Method is the HTTP method, one of GET (the default), HEAD, POST, PUT
+	// and OPTIONS.
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+	// Headers contains the additional request headers.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Host overrides the Host header sent to the server.
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+	// Body is the inline request body.
+	Body string `json:"body,omitempty" yaml:"body,omitempty"`
+	// BodyFile is the path to a file containing the request body.
+	BodyFile string `json:"body_file,omitempty" yaml:"body_file,omitempty"`
+	// Auth contains the credentials to authenticate the request with.
+	Auth *HTTPAuth `json:"auth,omitempty" yaml:"auth,omitempty"`
+	// FollowRedirects is whether redirects should be followed (the default).
+	FollowRedirects *bool `json:"follow_redirects,omitempty" yaml:"follow_redirects,omitempty"`
+	// MaxRedirects is the maximum number of redirects to follow.
+	MaxRedirects int `json:"max_redirects,omitempty" yaml:"max_redirects,omitempty"`
+	// Insecure disables the verification of the server certificate; it is
+	// a shorthand for the insecure flag in the check's TLS settings.
+	Insecure bool `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	// Proxy is the URL of the proxy to use; by default the proxy is taken from
+	// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, whereas
+	// "none" disables it altogether.
+	Proxy string `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+	// Expect contains the optional assertions on the response.
+	Expect *HTTPExpect `json:"expect,omitempty" yaml:"expect,omitempty"`
+}
+
+// HTTPAuth contains the credentials for an HTTP request; in order not to
+// store secrets in the bundle, it only holds the names of the environment
+// variables where the actual credentials are to be read from.
+type HTTPAuth struct {
+	// Type is the type of authentication, one of "basic" and "bearer".
+	Type string `json:"type" yaml:"type"`
+	// UsernameEnv is the name of the variable holding the basic auth username.
+	UsernameEnv string `json:"username_env,omitempty" yaml:"username_env,omitempty"`
+	// PasswordEnv is the name of the variable holding the basic auth password.
+	PasswordEnv string `json:"password_env,omitempty" yaml:"password_env,omitempty"`
+	// TokenEnv is the name of the variable holding the bearer token.
+	TokenEnv string `json:"token_env,omitempty" yaml:"token_env,omitempty"`
+}
+
+// HTTPExpect contains the assertions to verify on the HTTP response; if no
+// status is specified, any 2xx status code is accepted.
+type HTTPExpect struct {
+	// Status lists the accepted status codes, either as single values ("200"),
+	// classes ("2xx") or ranges ("200-204").
+	Status []string `json:"status,omitempty" yaml:"status,omitempty"`
+	// Headers maps the names of the required response headers to a regular
+	// expression their value must match; an empty expression only requires
+	// the header to be present.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// ForbiddenHeaders lists the headers that must not be in the response.
+	ForbiddenHeaders []string `json:"forbidden_headers,omitempty" yaml:"forbidden_headers,omitempty"`
+	// BodyContains is a substring that must be found in the response body.
+	BodyContains string `json:"body_contains,omitempty" yaml:"body_contains,omitempty"`
+	// BodyMatches is a regular expression the response body must match.
+	BodyMatches string `json:"body_matches,omitempty" yaml:"body_matches,omitempty"`
+	// JSON maps JSONPath-style paths (e.g. "$.status" or "$.items[0].name")
+	// to a regular expression the value at that path must match as a whole.
+	JSON map[string]string `json:"json,omitempty" yaml:"json,omitempty"`
+	// MaxBodySize is the maximum number of bytes read from the response body.
+	MaxBodySize int64 `json:"max_body_size,omitempty" yaml:"max_body_size,omitempty"`
+}
+
+// doHTTP places an HTTP(s) request to the check's address and verifies the
+// assertions on the response.
+func (c *Check) doHTTP() error {
+	options := c.HTTP
+	if options == nil {
+		options = &HTTPRequest{}
+	}
+
+	client, err := c.newHTTPClient()
+	if err != nil {
+		slog.Error("error creating HTTP(s) client", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error creating HTTP(s) client for %s: %w", c.Address, err)
+	}
+
+	address := c.Protocol.String() + "://" + c.Address
+
+	req, err := options.newRequest(address)
+	if err != nil {
+		slog.Error("error preparing HTTP(s) request", "address", address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error preparing request to HTTP(s) web site %s: %w", address, err)
+	}
+
+	slog.Debug("placing request to HTTP(s) server", "url", address, "method", req.Method)
+
+	resp, err := client.Do(req.WithContext(c.Result.Timing.trace(req.Context())))
+	if err != nil {
+		slog.Error("error connecting to HTTP(s) web site", "address", address, "protocol", c.Protocol.String(), "error", err, "type", fmt.Sprintf("%T", errors.Unwrap(err)))
+		return fmt.Errorf("error connecting to HTTP(s) web site %s: %w", address, err)
+	}
+	defer resp.Body.Close()
+	if resp.TLS != nil {
+		c.Result.TLS = newTLSResult(*resp.TLS)
+	}
+
+	expect := options.Expect
+	if expect == nil {
+		expect = &HTTPExpect{}
+	}
+	if err := expect.verify(resp); err != nil {
+		slog.Error("unexpected response from HTTP(s) web site", "address", address, "protocol", c.Protocol.String(), "status", resp.StatusCode, "error", err)
+		return withClass(ClassAssertionFailed, fmt.Errorf("unexpected response from HTTP(s) web site %s: %w", address, err))
+	}
+
+	if resp.TLS != nil {
+		chain := verifiedChain(*resp.TLS)
+		if err := c.verifyExpiry(chain); err != nil {
+			return err
+		}
+		if c.Certificate != nil {
+			if err := c.Certificate.verify(chain); err != nil {
+				slog.Error("unexpected certificate", "address", address, "protocol", c.Protocol.String(), "error", err)
+				return withClass(ClassAssertionFailed, fmt.Errorf("unexpected certificate from HTTP(s) web site %s: %w", address, err))
+			}
+		}
+	}
+
+	if c.Protocol == HTTPS && c.Audit != nil {
+		target := req.URL.Host
+		if req.URL.Port() == "" {
+			target = net.JoinHostPort(req.URL.Hostname(), "443")
+		}
+		if err := c.auditTLS(target); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("successfully tested connection", "address", address, "protocol", c.Protocol.String(), "status", resp.StatusCode)
+	return nil
+}
+
+// newRequest creates the HTTP request to the given address, with the method,
+// headers, body and credentials in the options.
+func (r *HTTPRequest) newRequest(address string) (*http.Request, error) {
+	method := strings.ToUpper(r.Method)
+	switch method {
+	case "":
+		method = http.MethodGet
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodOptions:
+	default:
+		return nil, fmt.Errorf("unsupported HTTP method: '%s'", r.Method)
+	}
+
+	var body io.Reader
+	if r.Body != "" && r.BodyFile != "" {
+		return nil, errors.New("request body cannot be both inline and from file")
+	} else if r.Body != "" {
+		body = strings.NewReader(r.Body)
+	} else if r.BodyFile != "" {
+		data, err := os.ReadFile(filepath.Clean(r.BodyFile))
+		if err != nil {
+			return nil, fmt.Errorf("error reading request body from %s: %w", r.BodyFile, err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, address, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range r.Headers {
+		req.Header.Set(name, value)
+	}
+	if r.Host != "" {
+		req.Host = r.Host
+	}
+
+	if r.Auth != nil {
+		switch strings.ToLower(r.Auth.Type) {
+		case "basic":
+			username, ok := os.LookupEnv(r.Auth.UsernameEnv)
+			if !ok {
+				return nil, fmt.Errorf("environment variable '%s' with basic auth username is not set", r.Auth.UsernameEnv)
+			}
+			password, ok := os.LookupEnv(r.Auth.PasswordEnv)
+			if !ok {
+				return nil, fmt.Errorf("environment variable '%s' with basic auth password is not set", r.Auth.PasswordEnv)
+			}
+			req.SetBasicAuth(username, password)
+		case "bearer":
+			token, ok := os.LookupEnv(r.Auth.TokenEnv)
+			if !ok {
+				return nil, fmt.Errorf("environment variable '%s' with bearer token is not set", r.Auth.TokenEnv)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		default:
+			return nil, fmt.Errorf("unsupported HTTP authentication type: '%s'", r.Auth.Type)
+		}
+	}
+	return req, nil
+}
+
+// checkRedirect applies the redirect policy: when redirects are not to be
+// followed, the redirect response itself is returned to the caller.
+func (r *HTTPRequest) checkRedirect(req *http.Request, via []*http.Request) error {
+	if r.FollowRedirects != nil && !*r.FollowRedirects {
+		return http.ErrUseLastResponse
+	}
+	limit := r.MaxRedirects
+	if limit <= 0 {
+		limit = DefaultHTTPMaxRedirects
+	}
+	if len(via) > limit {
+		return fmt.Errorf("stopped after %d redirects", limit)
+	}
+	return nil
+}
+
+// verify checks the HTTP response against the expectations, returning an
+// error describing the first one that is not met.
+func (e *HTTPExpect) verify(resp *http.Response) error {
+	// status code
+	if len(e.Status) == 0 {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("status code %d is not in 2xx", resp.StatusCode)
+		}
+	} else {
+		accepted := false
+		for _, status := range e.Status {
+			ok, err := matchStatus(status, resp.StatusCode)
+			if err != nil {
+				return err
+			}
+			if ok {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return fmt.Errorf("status code %d is not in %s", resp.StatusCode, strings.Join(e.Status, ", "))
+		}
+	}
+
+	// headers
+	for name, pattern := range e.Headers {
+		values, ok := resp.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return fmt.Errorf("required header %s is missing", name)
+		}
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression '%s' for header %s: %w", pattern, name, err)
+		}
+		if !re.MatchString(strings.Join(values, ", ")) {
+			return fmt.Errorf("header %s value '%s' does not match '%s'", name, strings.Join(values, ", "), pattern)
+		}
+	}
+	for _, name := range e.ForbiddenHeaders {
+		if _, ok := resp.Header[http.CanonicalHeaderKey(name)]; ok {
+			return fmt.Errorf("forbidden header %s is present", name)
+		}
+	}
+
+	// body
+	if e.BodyContains == "" && e.BodyMatches == "" && len(e.JSON) == 0 {
+		return nil
+	}
+	limit := e.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultHTTPMaxBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if e.BodyContains != "" && !bytes.Contains(body, []byte(e.BodyContains)) {
+		return fmt.Errorf("body does not contain '%s'", e.BodyContains)
+	}
+	if e.BodyMatches != "" {
+		re, err := regexp.Compile(e.BodyMatches)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression '%s' for body: %w", e.BodyMatches, err)
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("body does not match '%s'", e.BodyMatches)
+		}
+	}
+	if len(e.JSON) > 0 {
+		var document any
+		if err := json.Unmarshal(body, &document); err != nil {
+			return fmt.Errorf("body is not valid JSON: %w", err)
+		}
+		for path, pattern := range e.JSON {
+			value, err := lookupJSON(document, path)
+			if err != nil {
+				return err
+			}
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("invalid regular expression '%s' for JSON path %s: %w", pattern, path, err)
+			}
+			if !re.MatchString(value) {
+				return fmt.Errorf("value '%s' at JSON path %s does not match '%s'", value, path, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// matchStatus returns whether the status code is matched by the given
+// specification, which can be a single code, a class or a range.
+func matchStatus(spec string, code int) (bool, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if len(spec) == 3 && strings.HasSuffix(spec, "xx") && spec[0] >= '1' && spec[0] <= '5' {
+		return code/100 == int(spec[0]-'0'), nil
+	}
+	if from, to, ok := strings.Cut(spec, "-"); ok {
+		lower, err1 := strconv.Atoi(strings.TrimSpace(from))
+		upper, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil {
+			return false, fmt.Errorf("invalid status code range: '%s'", spec)
+		}
+		return code >= lower && code <= upper, nil
+	}
+	value, err := strconv.Atoi(spec)
+	if err != nil {
+		return false, fmt.Errorf("invalid status code: '%s'", spec)
+	}
+	return code == value, nil
+}
+
+// lookupJSON walks the decoded JSON document along the given path, which is
+// in the form "$.field.array[1].field" (the leading "$." is optional), and
+// returns the textual representation of the value it points to.
+func lookupJSON(document any, path string) (string, error) {
+	current := document
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if trimmed != "" {
+		for _, token := range strings.Split(strings.ReplaceAll(trimmed, "[", ".["), ".") {
+			if token == "" {
+				continue
+			}
+			if strings.HasPrefix(token, "[") && strings.HasSuffix(token, "]") {
+				index, err := strconv.Atoi(token[1 : len(token)-1])
+				if err != nil {
+					return "", fmt.Errorf("invalid index %s in JSON path %s", token, path)
+				}
+				array, ok := current.([]any)
+				if !ok || index < 0 || index >= len(array) {
+					return "", fmt.Errorf("JSON path %s not found in body", path)
+				}
+				current = array[index]
+			} else {
+				object, ok := current.(map[string]any)
+				if !ok {
+					return "", fmt.Errorf("JSON path %s not found in body", path)
+				}
+				if current, ok = object[token]; !ok {
+					return "", fmt.Errorf("JSON path %s not found in body", path)
+				}
+			}
+		}
+	}
+	if s, ok := current.(string); ok {
+		return s, nil
+	}
+	data, _ := json.Marshal(current)
+	return string(data), nil
+}
@@ -0,0 +1,141 @@
+package checks
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/pointer"
+)
+
+func TestHTTPExpect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Version", "1.2.3")
+		fmt.Fprint(w, `{"status": "UP", "components": [{"name": "db", "healthy": true}]}`)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "proxy")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "<html>upstream unavailable</html>")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		path    string
+		expect  *HTTPExpect
+		failure string
+	}{
+		{"/health", nil, ""},
+		{"/broken", nil, "status code 503"},
+		{"/broken", &HTTPExpect{Status: []string{"5xx"}}, ""},
+		{"/broken", &HTTPExpect{Status: []string{"200", "500-502"}}, "status code 503"},
+		{"/health", &HTTPExpect{Headers: map[string]string{"x-version": `^1\.`, "content-type": ""}}, ""},
+		{"/health", &HTTPExpect{Headers: map[string]string{"x-version": `^2\.`}}, "header x-version"},
+		{"/health", &HTTPExpect{Headers: map[string]string{"x-missing": ""}}, "required header x-missing"},
+		{"/broken", &HTTPExpect{Status: []string{"503"}, ForbiddenHeaders: []string{"server"}}, "forbidden header server"},
+		{"/health", &HTTPExpect{BodyContains: `"UP"`}, ""},
+		{"/health", &HTTPExpect{BodyMatches: `"status":\s*"DOWN"`}, "body does not match"},
+		{"/health", &HTTPExpect{JSON: map[string]string{"$.status": "UP", "$.components[0].healthy": "true"}}, ""},
+		{"/health", &HTTPExpect{JSON: map[string]string{"$.status": "U"}}, "at JSON path $.status"},
+		{"/health", &HTTPExpect{JSON: map[string]string{"$.components[3].name": "db"}}, "not found"},
+		{"/health", &HTTPExpect{BodyContains: "components", MaxBodySize: 10}, "body does not contain"},
+	}
+
+	for _, test := range tests {
+		check := &Check{
+			Address:  address + test.path,
+			Protocol: HTTP,
+			Timeout:  Timeout(2 * time.Second),
+			HTTP:     &HTTPRequest{Expect: test.expect},
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error checking %s: %v", test.path, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error checking %s, got none", test.path)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error checking %s: expected '%s', got '%v'", test.path, test.failure, err)
+		}
+	}
+}
+
+func TestHTTPRequest(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		username, password, _ := r.BasicAuth()
+		fmt.Fprintf(w, "method=%s host=%s key=%s user=%s:%s auth=%s body=%s", r.Method, r.Host, r.Header.Get("X-Api-Key"), username, password, r.Header.Get("Authorization"), body)
+	})
+	mux.HandleFunc("/redirect/{hops}", func(w http.ResponseWriter, r *http.Request) {
+		hops, _ := strconv.Atoi(r.PathValue("hops"))
+		if hops == 0 {
+			fmt.Fprint(w, "landed")
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", hops-1), http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	t.Setenv("NETCHECK_TEST_USERNAME", "alice")
+	t.Setenv("NETCHECK_TEST_PASSWORD", "s3cr3t")
+	t.Setenv("NETCHECK_TEST_TOKEN", "t0k3n")
+
+	body := filepath.Join(t.TempDir(), "body.json")
+	if err := os.WriteFile(body, []byte(`{"from": "file"}`), 0600); err != nil {
+		log.Fatalf("Could not write request body file: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		request HTTPRequest
+		failure string
+	}{
+		{"/echo", HTTPRequest{Method: "post", Body: "hello", Expect: &HTTPExpect{BodyContains: "method=POST"}}, ""},
+		{"/echo", HTTPRequest{Method: "put", BodyFile: body, Expect: &HTTPExpect{BodyContains: `body={"from": "file"}`}}, ""},
+		{"/echo", HTTPRequest{Method: "delete"}, "unsupported HTTP method"},
+		{"/echo", HTTPRequest{Headers: map[string]string{"X-Api-Key": "abc"}, Host: "api.example.com", Expect: &HTTPExpect{BodyMatches: "host=api.example.com key=abc"}}, ""},
+		{"/echo", HTTPRequest{Auth: &HTTPAuth{Type: "basic", UsernameEnv: "NETCHECK_TEST_USERNAME", PasswordEnv: "NETCHECK_TEST_PASSWORD"}, Expect: &HTTPExpect{BodyContains: "user=alice:s3cr3t"}}, ""},
+		{"/echo", HTTPRequest{Auth: &HTTPAuth{Type: "bearer", TokenEnv: "NETCHECK_TEST_TOKEN"}, Expect: &HTTPExpect{BodyContains: "auth=Bearer t0k3n"}}, ""},
+		{"/echo", HTTPRequest{Auth: &HTTPAuth{Type: "bearer", TokenEnv: "NETCHECK_TEST_MISSING"}}, "NETCHECK_TEST_MISSING"},
+		{"/redirect/3", HTTPRequest{Expect: &HTTPExpect{BodyContains: "landed"}}, ""},
+		{"/redirect/3", HTTPRequest{MaxRedirects: 2}, "stopped after 2 redirects"},
+		{"/redirect/3", HTTPRequest{MaxRedirects: 3, Expect: &HTTPExpect{BodyContains: "landed"}}, ""},
+		{"/redirect/4", HTTPRequest{MaxRedirects: 3}, "stopped after 3 redirects"},
+		{"/redirect/3", HTTPRequest{FollowRedirects: pointer.To(false), Expect: &HTTPExpect{Status: []string{"302"}, Headers: map[string]string{"Location": "^/redirect/2$"}}}, ""},
+	}
+
+	for _, test := range tests {
+		check := &Check{
+			Address:  address + test.path,
+			Protocol: HTTP,
+			Timeout:  Timeout(2 * time.Second),
+			HTTP:     &test.request,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error checking %s: %v", test.path, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error checking %s, got none", test.path)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error checking %s: expected '%s', got '%v'", test.path, test.failure, err)
+		}
+	}
+}
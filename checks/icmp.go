@@ -0,0 +1,225 @@
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	probing "github.com/prometheus-community/pro-bing"
+)
+
+// PingOptions contains the settings of ICMP checks; they can be given per
+// bundle and per check, the unset ones being taken from the bundle and then
+// from the defaults.
+type PingOptions struct {
+	// Count is the number of echo requests to send.
+	Count int `json:"count,omitempty" yaml:"count,omitempty"`
+	// Interval is the time between echo requests.
+	Interval Timeout `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Size is the size of the echo requests payload, in bytes.
+	Size int `json:"size,omitempty" yaml:"size,omitempty"`
+	// Mode is the kind of ICMP socket to use: "privileged" for raw sockets,
+	// which require CAP_NET_RAW on Linux, "unprivileged" for datagram sockets
+	// or "auto" (the default) to detect which ones are available.
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Expect contains the thresholds on packet loss and round trip times.
+	Expect *PingExpect `json:"expect,omitempty" yaml:"expect,omitempty"`
+}
+
+// PingExpect contains the thresholds on the statistics of an ICMP check; the
+// check fails if any of them is exceeded and, regardless of the thresholds,
+// if no echo reply is received at all.
+type PingExpect struct {
+	// MaxLoss is the maximum percentage of lost packets (e.g. 20 for 20%).
+	MaxLoss *float64 `json:"max_loss,omitempty" yaml:"max_loss,omitempty"`
+	// MaxAvgRTT is the maximum average round trip time.
+	MaxAvgRTT Timeout `json:"max_avg_rtt,omitempty" yaml:"max_avg_rtt,omitempty"`
+	// MaxRTT is the maximum round trip time of any echo reply.
+	MaxRTT Timeout `json:"max_rtt,omitempty" yaml:"max_rtt,omitempty"`
+	// MaxJitter is the maximum standard deviation of the round trip times.
+	MaxJitter Timeout `json:"max_jitter,omitempty" yaml:"max_jitter,omitempty"`
+}
+
+// PingResult contains the statistics collected in an ICMP check.
+type PingResult struct {
+	// Address is the address of the host, as given in the check.
+	Address string `json:"address" yaml:"address"`
+	// IP is the IP address the host resolved to.
+	IP string `json:"ip,omitempty" yaml:"ip,omitempty"`
+	// Sent is the number of echo requests sent.
+	Sent int `json:"sent" yaml:"sent"`
+	// Received is the number of echo replies received, duplicates excluded.
+	Received int `json:"received" yaml:"received"`
+	// Duplicates is the number of duplicate echo replies received.
+	Duplicates int `json:"duplicates" yaml:"duplicates"`
+	// Loss is the percentage of lost packets.
+	Loss float64 `json:"loss" yaml:"loss"`
+	// RTTs lists the round trip times of the echo replies.
+	RTTs []Timeout `json:"rtts,omitempty" yaml:"rtts,omitempty"`
+	// TTLs lists the TTLs of the echo replies.
+	TTLs []uint8 `json:"ttls,omitempty" yaml:"ttls,omitempty"`
+	// MinRTT is the minimum round trip time.
+	MinRTT Timeout `json:"min_rtt" yaml:"min_rtt"`
+	// AvgRTT is the average round trip time.
+	AvgRTT Timeout `json:"avg_rtt" yaml:"avg_rtt"`
+	// MaxRTT is the maximum round trip time.
+	MaxRTT Timeout `json:"max_rtt" yaml:"max_rtt"`
+	// Jitter is the standard deviation of the round trip times.
+	Jitter Timeout `json:"jitter" yaml:"jitter"`
+}
+
+// newPingResult converts the statistics of a pinger into a PingResult.
+func newPingResult(stats *probing.Statistics) *PingResult {
+	result := &PingResult{
+		Address:    stats.Addr,
+		Sent:       stats.PacketsSent,
+		Received:   stats.PacketsRecv,
+		Duplicates: stats.PacketsRecvDuplicates,
+		Loss:       stats.PacketLoss,
+		TTLs:       stats.TTLs,
+		MinRTT:     Timeout(stats.MinRtt),
+		AvgRTT:     Timeout(stats.AvgRtt),
+		MaxRTT:     Timeout(stats.MaxRtt),
+		Jitter:     Timeout(stats.StdDevRtt),
+	}
+	if stats.IPAddr != nil {
+		result.IP = stats.IPAddr.String()
+	}
+	for _, rtt := range stats.Rtts {
+		result.RTTs = append(result.RTTs, Timeout(rtt))
+	}
+	return result
+}
+
+// withDefaults returns a copy of the options where the unset values are taken
+// from the given defaults.
+func (o *PingOptions) withDefaults(defaults *PingOptions) *PingOptions {
+	if o == nil {
+		o = &PingOptions{}
+	}
+	result := *o
+	if defaults == nil {
+		return &result
+	}
+	if result.Count <= 0 {
+		result.Count = defaults.Count
+	}
+	if result.Interval <= 0 {
+		result.Interval = defaults.Interval
+	}
+	if result.Size <= 0 {
+		result.Size = defaults.Size
+	}
+	if result.Mode == "" {
+		result.Mode = defaults.Mode
+	}
+	if result.Expect == nil {
+		result.Expect = defaults.Expect
+	}
+	return &result
+}
+
+// privileged returns whether ICMP echo requests are to be sent through raw
+// sockets, detecting it in auto mode.
+func (o *PingOptions) privileged() (bool, error) {
+	switch o.Mode {
+	case "", "auto":
+		return detectPrivileged()
+	case "privileged":
+		return true, nil
+	case "unprivileged":
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported ICMP mode: '%s'", o.Mode)
+}
+
+// verify checks the statistics against the thresholds.
+func (e *PingExpect) verify(result *PingResult) error {
+	if result.Received == 0 {
+		return withClass(ClassTimeout, errors.New("no echo reply received"))
+	}
+	if e == nil {
+		return nil
+	}
+	if e.MaxLoss != nil && result.Loss > *e.MaxLoss {
+		return withClass(ClassAssertionFailed, fmt.Errorf("packet loss %.1f%% exceeds %.1f%%", result.Loss, *e.MaxLoss))
+	}
+	if e.MaxAvgRTT > 0 && result.AvgRTT > e.MaxAvgRTT {
+		return withClass(ClassAssertionFailed, fmt.Errorf("average round trip time %s exceeds %s", result.AvgRTT, e.MaxAvgRTT))
+	}
+	if e.MaxRTT > 0 && result.MaxRTT > e.MaxRTT {
+		return withClass(ClassAssertionFailed, fmt.Errorf("maximum round trip time %s exceeds %s", result.MaxRTT, e.MaxRTT))
+	}
+	if e.MaxJitter > 0 && result.Jitter > e.MaxJitter {
+		return withClass(ClassAssertionFailed, fmt.Errorf("jitter %s exceeds %s", result.Jitter, e.MaxJitter))
+	}
+	return nil
+}
+
+// doICMP pings the check's address and verifies the statistics against the
+// thresholds, if any.
+func (c *Check) doICMP() error {
+	options := c.pingOptions()
+	pinger, err := c.newPinger(c.Address, options)
+	if err != nil {
+		return err
+	}
+	pinger.Timeout = time.Duration(c.Timeout)
+	pinger.Count = options.Count
+	pinger.Size = options.Size
+
+	pinger.OnFinish = func(stats *probing.Statistics) {
+		slog.Debug("ping statistics", "destination", stats.Addr, "transmitted", stats.PacketsSent, "received", stats.PacketsRecv, "loss_percent", stats.PacketLoss, "roundtrip_min", stats.MinRtt, "roundtrip_avg", stats.AvgRtt, "roundtrip_max", stats.MaxRtt, "roundtrip_stddev", stats.StdDevRtt)
+	}
+
+	err = pinger.Run()
+	if err != nil {
+		slog.Error("error running ping", "endpoint", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error running ping against %s: %w", c.Address, err)
+	}
+	c.Result.Ping = newPingResult(pinger.Statistics())
+	if err := options.Expect.verify(c.Result.Ping); err != nil {
+		slog.Error("unexpected ping statistics", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("unexpected ping statistics for %s: %w", c.Address, err)
+	}
+	slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "loss", c.Result.Ping.Loss, "rtt", c.Result.Ping.AvgRTT)
+	return nil
+}
+
+// pingOptions returns the check's ping settings, the unset ones being taken
+// from the defaults.
+func (c *Check) pingOptions() *PingOptions {
+	return c.Ping.withDefaults(&PingOptions{
+		Count:    *Default.Ping.Count,
+		Interval: *Default.Ping.Interval,
+		Size:     *Default.Ping.Size,
+		Mode:     *Default.Ping.Mode,
+	})
+}
+
+// newPinger returns a pinger towards the given address, using the kind of
+// ICMP socket and the interval in the given settings.
+func (c *Check) newPinger(address string, options *PingOptions) (*probing.Pinger, error) {
+	privileged, err := options.privileged()
+	if err != nil {
+		slog.Error("error preparing ICMP socket", "address", address, "protocol", c.Protocol.String(), "mode", options.Mode, "error", err)
+		return nil, fmt.Errorf("error preparing ICMP socket for %s: %w", address, err)
+	}
+	pinger, err := probing.NewPinger(address)
+	if err != nil {
+		slog.Error("error creating ICMP client", "address", address, "protocol", c.Protocol.String(), "error", err)
+		return nil, fmt.Errorf("error creating ICMP client to %s: %w", address, err)
+	}
+	pinger.SetPrivileged(privileged)
+	pinger.Interval = time.Duration(options.Interval)
+
+	pinger.OnRecv = func(pkt *probing.Packet) {
+		slog.Debug("received ping response", "bytes", pkt.Nbytes, "endpoint", pkt.IPAddr, "sequence", pkt.Seq, "rtt", pkt.Rtt, "ttl", pkt.TTL)
+	}
+
+	pinger.OnDuplicateRecv = func(pkt *probing.Packet) {
+		slog.Debug("received duplicate ping response", "bytes", pkt.Nbytes, "endpoint", pkt.IPAddr, "sequence", pkt.Seq, "rtt", pkt.Rtt, "ttl", pkt.TTL)
+	}
+	return pinger, nil
+}
@@ -0,0 +1,74 @@
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pingGroupRange is the kernel setting listing the groups allowed to open
+// unprivileged ICMP sockets.
+const pingGroupRange = "/proc/sys/net/ipv4/ping_group_range"
+
+// detectPrivileged returns whether ICMP echo requests should be sent through
+// raw sockets, which require CAP_NET_RAW, or through unprivileged datagram
+// sockets, which require the process's group to be in ping_group_range.
+func detectPrivileged() (bool, error) {
+	if conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0"); err == nil {
+		conn.Close()
+		return true, nil
+	}
+	// the supplementary groups are only a bonus, the effective one is enough
+	groups, _ := os.Getgroups()
+	groups = append(groups, os.Getegid())
+	allowed, limits, err := pingGroupAllowed(pingGroupRange, groups)
+	if err != nil {
+		slog.Warn("error reading unprivileged ICMP settings", "path", pingGroupRange, "error", err)
+		return false, nil
+	}
+	if !allowed {
+		return false, fmt.Errorf("ICMP sockets unavailable: raw sockets require CAP_NET_RAW (e.g. setcap cap_net_raw=+ep %s), unprivileged ones require group %d to be within net.ipv4.ping_group_range (%s)", executable(), os.Getegid(), limits)
+	}
+	return false, nil
+}
+
+// pingGroupAllowed returns whether any of the given groups is within the range
+// in the ping_group_range file at the given path, along with the range.
+func pingGroupAllowed(path string, groups []int) (bool, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, "", err
+	}
+	fields := strings.Fields(string(data))
+	limits := strings.Join(fields, " ")
+	if len(fields) != 2 {
+		return false, limits, errors.New("malformed group range")
+	}
+	low, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return false, limits, fmt.Errorf("malformed group range: %w", err)
+	}
+	high, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return false, limits, fmt.Errorf("malformed group range: %w", err)
+	}
+	for _, group := range groups {
+		if int64(group) >= low && int64(group) <= high {
+			return true, limits, nil
+		}
+	}
+	return false, limits, nil
+}
+
+// executable returns the path to the running binary, for error messages.
+func executable() string {
+	path, err := os.Executable()
+	if err != nil {
+		return "/path/to/netcheck"
+	}
+	return path
+}
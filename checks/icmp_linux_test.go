@@ -0,0 +1,45 @@
+package checks
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPingGroupAllowed(t *testing.T) {
+	directory := t.TempDir()
+
+	tests := []struct {
+		content string
+		groups  []int
+		allowed bool
+		failure bool
+	}{
+		{"0\t2147483647\n", []int{1000}, true, false},
+		{"1\t0\n", []int{0, 1000}, false, false},
+		{"100 200\n", []int{50, 150}, true, false},
+		{"100 200\n", []int{50, 250}, false, false},
+		{"100\n", []int{100}, false, true},
+		{"a b\n", []int{100}, false, true},
+	}
+
+	for i, test := range tests {
+		path := filepath.Join(directory, "ping_group_range")
+		if err := os.WriteFile(path, []byte(test.content), 0600); err != nil {
+			log.Fatalf("Could not write group range: %v", err)
+		}
+		allowed, _, err := pingGroupAllowed(path, test.groups)
+		switch {
+		case test.failure && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case !test.failure && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case allowed != test.allowed:
+			log.Fatalf("Unexpected outcome in test %d: expected %t, got %t", i, test.allowed, allowed)
+		}
+	}
+	if _, _, err := pingGroupAllowed(filepath.Join(directory, "missing"), []int{0}); err == nil {
+		log.Fatalf("Expected error for missing file, got none")
+	}
+}
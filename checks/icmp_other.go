@@ -0,0 +1,14 @@
+//go:build !linux
+
+package checks
+
+import (
+	"runtime"
+)
+
+// detectPrivileged returns whether ICMP echo requests should be sent through
+// raw sockets: Windows only supports those, whereas other systems (e.g. macOS)
+// allow unprivileged datagram sockets.
+func detectPrivileged() (bool, error) {
+	return runtime.GOOS == "windows", nil
+}
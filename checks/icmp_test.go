@@ -0,0 +1,102 @@
+package checks
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/pointer"
+)
+
+func TestPingOptions(t *testing.T) {
+	expect := &PingExpect{MaxLoss: pointer.To(10.0)}
+	bundle := &PingOptions{Count: 5, Interval: Timeout(time.Second), Expect: expect}
+
+	tests := []struct {
+		check    *PingOptions
+		defaults *PingOptions
+		expected PingOptions
+	}{
+		{nil, bundle, PingOptions{Count: 5, Interval: Timeout(time.Second), Expect: expect}},
+		{&PingOptions{Count: 3}, bundle, PingOptions{Count: 3, Interval: Timeout(time.Second), Expect: expect}},
+		{&PingOptions{Size: 1400, Expect: &PingExpect{}}, bundle, PingOptions{Count: 5, Interval: Timeout(time.Second), Size: 1400, Expect: &PingExpect{}}},
+		{&PingOptions{Count: 3}, nil, PingOptions{Count: 3}},
+		{nil, nil, PingOptions{}},
+	}
+
+	for i, test := range tests {
+		options := test.check.withDefaults(test.defaults)
+		if options.Count != test.expected.Count || options.Interval != test.expected.Interval || options.Size != test.expected.Size || (options.Expect == nil) != (test.expected.Expect == nil) {
+			log.Fatalf("Unexpected options in test %d: expected %+v, got %+v", i, test.expected, *options)
+		}
+	}
+	if bundle.Count != 5 || bundle.Size != 0 {
+		log.Fatalf("Bundle options modified: %+v", *bundle)
+	}
+}
+
+func TestPingExpect(t *testing.T) {
+	result := &PingResult{
+		Sent:     10,
+		Received: 8,
+		Loss:     20,
+		MinRTT:   Timeout(10 * time.Millisecond),
+		AvgRTT:   Timeout(20 * time.Millisecond),
+		MaxRTT:   Timeout(50 * time.Millisecond),
+		Jitter:   Timeout(5 * time.Millisecond),
+	}
+
+	tests := []struct {
+		result  *PingResult
+		expect  *PingExpect
+		failure string
+	}{
+		{result, nil, ""},
+		{&PingResult{Sent: 10, Loss: 100}, nil, "no echo reply received"},
+		{&PingResult{Sent: 10, Loss: 100}, &PingExpect{MaxLoss: pointer.To(100.0)}, "no echo reply received"},
+		{result, &PingExpect{MaxLoss: pointer.To(20.0)}, ""},
+		{result, &PingExpect{MaxLoss: pointer.To(0.0)}, "packet loss 20.0% exceeds 0.0%"},
+		{result, &PingExpect{MaxAvgRTT: Timeout(30 * time.Millisecond)}, ""},
+		{result, &PingExpect{MaxAvgRTT: Timeout(15 * time.Millisecond)}, "average round trip time 20ms exceeds 15ms"},
+		{result, &PingExpect{MaxRTT: Timeout(40 * time.Millisecond)}, "maximum round trip time 50ms exceeds 40ms"},
+		{result, &PingExpect{MaxJitter: Timeout(time.Millisecond)}, "jitter 5ms exceeds 1ms"},
+		{result, &PingExpect{MaxLoss: pointer.To(25.0), MaxAvgRTT: Timeout(time.Second), MaxRTT: Timeout(time.Second), MaxJitter: Timeout(time.Second)}, ""},
+	}
+
+	for i, test := range tests {
+		err := test.expect.verify(test.result)
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		}
+	}
+}
+
+func TestPingMode(t *testing.T) {
+	tests := []struct {
+		mode       string
+		privileged bool
+		failure    bool
+	}{
+		{"privileged", true, false},
+		{"unprivileged", false, false},
+		{"raw", false, true},
+	}
+
+	for i, test := range tests {
+		privileged, err := (&PingOptions{Mode: test.mode}).privileged()
+		switch {
+		case test.failure && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case !test.failure && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case privileged != test.privileged:
+			log.Fatalf("Unexpected mode in test %d: expected %t, got %t", i, test.privileged, privileged)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package checks
+
+import (
+	"slices"
+	"strings"
+)
+
+// InventoryItem is a certificate in the inventory, along with the endpoints
+// that presented it and the TLS sessions negotiated with them.
+type InventoryItem struct {
+	Certificate `yaml:",inline"`
+	Endpoints   []string           `json:"endpoints" yaml:"endpoints"`
+	Sessions    []InventorySession `json:"sessions" yaml:"sessions"`
+}
+
+// InventorySession is the TLS session negotiated with an endpoint that
+// presented a certificate in the inventory.
+type InventorySession struct {
+	Endpoint    string `json:"endpoint" yaml:"endpoint"`
+	Version     string `json:"version" yaml:"version"`
+	CipherSuite string `json:"cipher_suite" yaml:"cipher_suite"`
+	ALPN        string `json:"alpn,omitempty" yaml:"alpn,omitempty"`
+}
+
+// Inventory collects the certificates presented by the servers in all the TLS,
+// DTLS and HTTPS checks of the given bundles, deduplicates them by fingerprint
+// and returns them sorted by expiry, soonest first.
+func Inventory(bundles ...*Bundle) []InventoryItem {
+	index := map[string]*InventoryItem{}
+	for _, bundle := range bundles {
+		for _, check := range bundle.Checks {
+			if check.Result.TLS == nil {
+				continue
+			}
+			endpoint := check.Protocol.String() + "://" + check.Address
+			for _, certificate := range check.Result.TLS.Certificates {
+				item, ok := index[certificate.Fingerprint]
+				if !ok {
+					item = &InventoryItem{
+						Certificate: certificate,
+					}
+					index[certificate.Fingerprint] = item
+				}
+				if !slices.Contains(item.Endpoints, endpoint) {
+					item.Endpoints = append(item.Endpoints, endpoint)
+					item.Sessions = append(item.Sessions, InventorySession{
+						Endpoint:    endpoint,
+						Version:     check.Result.TLS.Version,
+						CipherSuite: check.Result.TLS.CipherSuite,
+						ALPN:        check.Result.TLS.ALPN,
+					})
+				}
+			}
+		}
+	}
+
+	items := make([]InventoryItem, 0, len(index))
+	for _, item := range index {
+		items = append(items, *item)
+	}
+	slices.SortFunc(items, func(a, b InventoryItem) int {
+		if c := a.NotAfter.Compare(b.NotAfter); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Fingerprint, b.Fingerprint)
+	})
+	return items
+}
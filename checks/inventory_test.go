@@ -0,0 +1,76 @@
+package checks
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+)
+
+func TestInventory(t *testing.T) {
+	ca := newTestCA("Test Root CA")
+	short := newTestServerCertificate(ca, time.Now().Add(30*24*time.Hour))
+	long := newTestServerCertificate(ca, time.Now().Add(300*24*time.Hour))
+
+	first, stop := startTLSServer(serverConfig(long, ca))
+	defer stop()
+	second, stop := startTLSServer(serverConfig(short, ca))
+	defer stop()
+
+	bundle := &Bundle{
+		Timeout:     Timeout(2 * time.Second),
+		Retries:     1,
+		Concurrency: 2,
+		TLS:         &tlsconfig.Options{CA: ca.CertPEM},
+		Checks: []Check{
+			{Address: first, Protocol: TLS},
+			{Address: second, Protocol: TLS},
+			{Address: first, Protocol: TLS, Name: "same endpoint, again"},
+		},
+	}
+	bundle.Check()
+
+	for _, check := range bundle.Checks {
+		if check.Result.IsError() {
+			log.Fatalf("Unexpected error checking %s: %v", check.Address, check.Result.String())
+		}
+		if check.Result.TLS == nil || len(check.Result.TLS.Certificates) != 2 {
+			log.Fatalf("Unexpected TLS details for %s: %+v", check.Address, check.Result.TLS)
+		}
+		leaf := check.Result.TLS.Certificates[0]
+		if leaf.KeyType != "ECDSA" || leaf.KeySize != 256 || len(leaf.SANs) != 3 || len(leaf.Fingerprint) != 64 {
+			log.Fatalf("Unexpected certificate details: %+v", leaf)
+		}
+		if check.Result.TLS.Version != "TLS 1.3" {
+			log.Fatalf("Unexpected TLS version: %s", check.Result.TLS.Version)
+		}
+	}
+
+	items := Inventory(bundle)
+	if len(items) != 3 {
+		log.Fatalf("Expected 3 distinct certificates, got %d", len(items))
+	}
+	if items[0].Subject != "CN=localhost" || !items[0].NotAfter.Equal(short.certificate.NotAfter) {
+		log.Fatalf("Certificate expiring first is not first in inventory: %+v", items[0])
+	}
+	if items[2].Subject != "CN=Test Root CA" || len(items[2].Endpoints) != 2 {
+		log.Fatalf("CA certificate not deduplicated across endpoints: %+v", items[2])
+	}
+	if len(items[1].Endpoints) != 1 {
+		log.Fatalf("Endpoints not deduplicated: %v", items[1].Endpoints)
+	}
+	for _, item := range items {
+		if len(item.Sessions) != len(item.Endpoints) {
+			log.Fatalf("Sessions do not match endpoints: %+v", item)
+		}
+		for i, session := range item.Sessions {
+			if session.Endpoint != item.Endpoints[i] || session.Version != "TLS 1.3" || session.CipherSuite == "" {
+				log.Fatalf("Unexpected session details: %+v", session)
+			}
+		}
+		if item.NotBefore.IsZero() || item.SignatureAlgorithm != "ECDSA-SHA256" {
+			log.Fatalf("Unexpected certificate details: %+v", item.Certificate)
+		}
+	}
+}
@@ -188,7 +188,7 @@ var MockBundles = []TrackedBundle{
 				address:     tracked.New("localhost:6379"),
 				protocol:    tracked.New(TLS),
 				result: tracked.New(Result{
-					err: nil,
+					warning: withClass(ClassCertificateExpiring, fmt.Errorf(expiringFormat, "CN=localhost", "localhost:6379", TLS.String(), "2026-01-01T00:00:00Z", Timeout(720*time.Hour))),
 				}),
 			},
 			{
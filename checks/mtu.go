@@ -0,0 +1,145 @@
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	// mtuHeaderIPv4 and mtuHeaderIPv6 are the sizes of the IP and ICMP
+	// headers of the probes, below which no MTU can be probed.
+	mtuHeaderIPv4 = 20 + 8
+	mtuHeaderIPv6 = 40 + 8
+	// DefaultMaxMTU is the largest MTU probed in path MTU checks, unless
+	// otherwise specified.
+	DefaultMaxMTU = 1500
+	// mtuProbes is the number of echo requests sent for each probed size; a
+	// single reply is enough for the size to fit.
+	mtuProbes = 3
+)
+
+// MTUOptions contains the settings of path MTU checks.
+type MTUOptions struct {
+	// Min is the minimum acceptable path MTU.
+	Min int `json:"min,omitempty" yaml:"min,omitempty"`
+	// Max is the largest MTU probed (1500 by default); use 9000 to detect
+	// jumbo frames support.
+	Max int `json:"max,omitempty" yaml:"max,omitempty"`
+}
+
+// MTUResult contains the outcome of a path MTU check.
+type MTUResult struct {
+	// MTU is the path MTU to the host, as the size of the largest IP packet
+	// that went through unfragmented.
+	MTU int `json:"mtu" yaml:"mtu"`
+	// Probes is the number of probed sizes.
+	Probes int `json:"probes" yaml:"probes"`
+}
+
+// validate returns an error if the minimum or the maximum MTU cannot even
+// hold the headers of the probes, whose size depends on the IP version.
+func (o *MTUOptions) validate(header int) error {
+	if o == nil {
+		return nil
+	}
+	if o.Max > 0 && o.Max < header {
+		return fmt.Errorf("maximum MTU %d is smaller than the %d bytes of the IP and ICMP headers", o.Max, header)
+	}
+	if o.Min > 0 && o.Min < header {
+		return fmt.Errorf("minimum MTU %d is smaller than the %d bytes of the IP and ICMP headers", o.Min, header)
+	}
+	return nil
+}
+
+// doMTU discovers the path MTU to the check's address by sending ICMP echo
+// requests of different sizes with the don't fragment bit set, looking for the
+// largest one receiving a reply, and fails if it is below the minimum.
+func (c *Check) doMTU() error {
+	options := c.MTU
+	if options == nil {
+		options = &MTUOptions{}
+	}
+	ping := c.pingOptions()
+
+	ip, err := net.ResolveIPAddr("ip", c.Address)
+	if err != nil {
+		slog.Error("error resolving address", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error resolving %s: %w", c.Address, err)
+	}
+	// the IP and ICMP headers, and the minimum MTU every link must support
+	header, lowest := mtuHeaderIPv4, 576
+	if ip.IP.To4() == nil {
+		header, lowest = mtuHeaderIPv6, 1280
+	}
+	if err := options.validate(header); err != nil {
+		slog.Error("invalid MTU settings", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("invalid MTU settings for %s: %w", c.Address, err)
+	}
+	highest := options.Max
+	if highest <= 0 {
+		highest = DefaultMaxMTU
+	}
+	lowest = min(lowest, highest)
+
+	c.Result.MTU = &MTUResult{}
+	fits := func(mtu int) (bool, error) {
+		c.Result.MTU.Probes++
+		pinger, err := c.newPinger(ip.String(), ping)
+		if err != nil {
+			return false, err
+		}
+		pinger.SetDoNotFragment(true)
+		pinger.Count = mtuProbes
+		pinger.Size = mtu - header
+		pinger.Timeout = min(time.Duration(c.Timeout), time.Duration(DefaultPingTimeout))
+		if err := pinger.Run(); err != nil {
+			if errors.Is(err, syscall.EMSGSIZE) {
+				// larger than the MTU of the local interface or of a known path
+				slog.Debug("probe too large", "address", c.Address, "mtu", mtu)
+				return false, nil
+			}
+			return false, err
+		}
+		received := pinger.Statistics().PacketsRecv > 0
+		slog.Debug("probed path MTU", "address", c.Address, "mtu", mtu, "fits", received)
+		return received, nil
+	}
+
+	ok, err := fits(lowest)
+	if err != nil {
+		slog.Error("error probing path MTU", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error probing path MTU to %s: %w", c.Address, err)
+	}
+	if !ok {
+		slog.Error("no reply to smallest probe", "address", c.Address, "protocol", c.Protocol.String(), "mtu", lowest)
+		return withClass(ClassTimeout, fmt.Errorf("no reply from %s to %d-byte packets", c.Address, lowest))
+	}
+	// binary search, lowest always fits whereas highest (unless probed) does not
+	if ok, err = fits(highest); err == nil && ok {
+		lowest = highest
+	}
+	for err == nil && highest-lowest > 1 {
+		middle := (lowest + highest) / 2
+		if ok, err = fits(middle); ok {
+			lowest = middle
+		} else {
+			highest = middle
+		}
+	}
+	if err != nil {
+		slog.Error("error probing path MTU", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error probing path MTU to %s: %w", c.Address, err)
+	}
+	c.Result.MTU.MTU = lowest
+
+	if lowest < options.Min {
+		slog.Error("path MTU below minimum", "address", c.Address, "mtu", lowest, "minimum", options.Min)
+		return withClass(ClassAssertionFailed, fmt.Errorf("path MTU to %s is %d, below the minimum of %d", c.Address, lowest, options.Min))
+	}
+	slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "mtu", lowest)
+	return nil
+}
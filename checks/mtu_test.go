@@ -0,0 +1,49 @@
+package checks
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMTU(t *testing.T) {
+	if _, err := detectPrivileged(); err != nil {
+		t.Skipf("ICMP sockets unavailable: %v", err)
+	}
+
+	tests := []struct {
+		options *MTUOptions
+		mtu     int
+		failure string
+	}{
+		{nil, DefaultMaxMTU, ""},
+		{&MTUOptions{Max: 9000}, 9000, ""},
+		{&MTUOptions{Min: 1400, Max: 1400}, 1400, ""},
+		{&MTUOptions{Min: 9000}, DefaultMaxMTU, "below the minimum of 9000"},
+		{&MTUOptions{Max: 20}, 0, "maximum MTU 20 is smaller than the 28 bytes"},
+		{&MTUOptions{Min: 10}, 0, "minimum MTU 10 is smaller than the 28 bytes"},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  "127.0.0.1",
+			Protocol: MTU,
+			Timeout:  Timeout(2 * time.Second),
+			MTU:      test.options,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		case test.mtu == 0 && check.Result.MTU != nil:
+			log.Fatalf("Unexpected path MTU in test %d: %+v", i, check.Result.MTU)
+		case test.mtu != 0 && (check.Result.MTU == nil || check.Result.MTU.MTU != test.mtu):
+			log.Fatalf("Unexpected path MTU in test %d: expected %d, got %+v", i, test.mtu, check.Result.MTU)
+		}
+	}
+}
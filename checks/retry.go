@@ -0,0 +1,144 @@
+package checks
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// DefaultRetryMaxWait is the maximum wait between successive attempts with a
+// linear or exponential backoff, unless otherwise specified.
+const DefaultRetryMaxWait = Timeout(time.Minute)
+
+// RetryPolicy contains the settings of the retries of a failed check: how
+// long to wait between successive attempts and which errors are worth
+// retrying; the base wait time is the check's wait.
+type RetryPolicy struct {
+	// Backoff is how the wait grows with the attempts: "fixed" (the default)
+	// always waits the same time, "linear" waits the base time multiplied by
+	// the number of failed attempts and "exponential" doubles the wait after
+	// each failed attempt.
+	Backoff string `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	// MaxWait caps the wait between successive attempts; with a linear or
+	// exponential backoff it defaults to DefaultRetryMaxWait.
+	MaxWait Timeout `json:"max_wait,omitempty" yaml:"max_wait,omitempty"`
+	// Jitter is the fraction of the wait (between 0 and 1) randomly added
+	// to or subtracted from it, so that checks failing together do not
+	// retry in lockstep.
+	Jitter float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	// RetryOn lists the error classes worth retrying; if set, failures of
+	// any other class are not retried.
+	RetryOn []ErrorClass `json:"retry_on,omitempty" yaml:"retry_on,omitempty"`
+	// NoRetryOn lists the error classes that are not worth retrying (e.g.
+	// hostname_mismatch), failing the check immediately.
+	NoRetryOn []ErrorClass `json:"no_retry_on,omitempty" yaml:"no_retry_on,omitempty"`
+}
+
+// withDefaults returns a copy of the policy where the unset values are taken
+// from the given defaults.
+func (p *RetryPolicy) withDefaults(defaults *RetryPolicy) *RetryPolicy {
+	if p == nil {
+		p = &RetryPolicy{}
+	}
+	result := *p
+	if defaults == nil {
+		return &result
+	}
+	if result.Backoff == "" {
+		result.Backoff = defaults.Backoff
+	}
+	if result.MaxWait <= 0 {
+		result.MaxWait = defaults.MaxWait
+	}
+	if result.Jitter <= 0 {
+		result.Jitter = defaults.Jitter
+	}
+	if result.RetryOn == nil {
+		result.RetryOn = defaults.RetryOn
+	}
+	if result.NoRetryOn == nil {
+		result.NoRetryOn = defaults.NoRetryOn
+	}
+	return &result
+}
+
+// validate returns an error if the policy has an unsupported backoff
+// strategy or an unknown error class, so that it is rejected when the bundle
+// is loaded.
+func (p *RetryPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Backoff {
+	case "", "fixed", "linear", "exponential":
+	default:
+		return fmt.Errorf("unsupported backoff strategy: '%s'", p.Backoff)
+	}
+	for _, class := range p.RetryOn {
+		if !slices.Contains(errorClasses, class) {
+			return fmt.Errorf("unknown error class in retry_on: '%s'", class)
+		}
+	}
+	for _, class := range p.NoRetryOn {
+		if !slices.Contains(errorClasses, class) {
+			return fmt.Errorf("unknown error class in no_retry_on: '%s'", class)
+		}
+	}
+	return nil
+}
+
+// retryable returns whether the failure is worth another attempt; without a
+// policy, all failures are.
+func (p *RetryPolicy) retryable(err error) bool {
+	if p == nil {
+		return true
+	}
+	class := classify(err)
+	if len(p.RetryOn) > 0 && !slices.Contains(p.RetryOn, class) {
+		return false
+	}
+	return !slices.Contains(p.NoRetryOn, class)
+}
+
+// wait returns how long to wait after the given number of failed attempts,
+// starting from the base wait time; the wait is capped before applying the
+// jitter, which never takes it above the maximum.
+func (p *RetryPolicy) wait(failed int, base Timeout) time.Duration {
+	wait := time.Duration(base)
+	if p == nil {
+		return wait
+	}
+	limit := time.Duration(p.MaxWait)
+	switch p.Backoff {
+	case "linear":
+		if limit <= 0 {
+			limit = time.Duration(DefaultRetryMaxWait)
+		}
+		// stop growing once above the cap
+		for i := 1; i < failed && wait < limit; i++ {
+			wait += time.Duration(base)
+		}
+	case "exponential":
+		if limit <= 0 {
+			limit = time.Duration(DefaultRetryMaxWait)
+		}
+		// stop doubling once above the cap, or before overflowing
+		for i := 1; i < failed && wait < limit && wait < time.Duration(1<<62); i++ {
+			wait *= 2
+		}
+	}
+	if limit > 0 && wait > limit {
+		wait = limit
+	}
+	if jitter := min(p.Jitter, 1); jitter > 0 {
+		spread := float64(wait) * jitter
+		// only as much above the wait as the cap allows
+		above := spread
+		if limit > 0 {
+			above = min(above, float64(limit-wait))
+		}
+		wait += time.Duration(rand.Float64()*(spread+above) - spread)
+	}
+	return wait
+}
@@ -0,0 +1,134 @@
+package checks
+
+import (
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryWait(t *testing.T) {
+	base := Timeout(100 * time.Millisecond)
+	tests := []struct {
+		policy *RetryPolicy
+		failed int
+		wait   time.Duration
+	}{
+		{nil, 3, 100 * time.Millisecond},
+		{&RetryPolicy{}, 3, 100 * time.Millisecond},
+		{&RetryPolicy{Backoff: "fixed"}, 3, 100 * time.Millisecond},
+		{&RetryPolicy{Backoff: "linear"}, 1, 100 * time.Millisecond},
+		{&RetryPolicy{Backoff: "linear"}, 3, 300 * time.Millisecond},
+		{&RetryPolicy{Backoff: "exponential"}, 1, 100 * time.Millisecond},
+		{&RetryPolicy{Backoff: "exponential"}, 4, 800 * time.Millisecond},
+		{&RetryPolicy{Backoff: "exponential", MaxWait: Timeout(time.Second)}, 10, time.Second},
+		{&RetryPolicy{Backoff: "exponential", MaxWait: Timeout(time.Second)}, 1000, time.Second},
+		{&RetryPolicy{Backoff: "linear", MaxWait: Timeout(250 * time.Millisecond)}, 3, 250 * time.Millisecond},
+		{&RetryPolicy{Backoff: "linear"}, 1000, time.Duration(DefaultRetryMaxWait)},
+		{&RetryPolicy{Backoff: "exponential"}, 1000, time.Duration(DefaultRetryMaxWait)},
+		{&RetryPolicy{Backoff: "fixed", MaxWait: Timeout(50 * time.Millisecond)}, 3, 50 * time.Millisecond},
+		{&RetryPolicy{Backoff: "fibonacci"}, 3, 100 * time.Millisecond},
+	}
+
+	for i, test := range tests {
+		if wait := test.policy.wait(test.failed, base); wait != test.wait {
+			log.Fatalf("Unexpected wait in test %d: expected %s, got %s", i, test.wait, wait)
+		}
+	}
+
+	// the jitter stays within the given fraction of the wait
+	policy := &RetryPolicy{Backoff: "exponential", Jitter: 0.5}
+	varied := false
+	for range 100 {
+		wait := policy.wait(2, base)
+		if wait < 100*time.Millisecond || wait > 300*time.Millisecond {
+			log.Fatalf("Unexpected wait with jitter: %s", wait)
+		}
+		varied = varied || wait != 200*time.Millisecond
+	}
+	if !varied {
+		log.Fatalf("Jitter did not vary the wait")
+	}
+
+	// the jitter never takes the wait above the maximum, but can still
+	// shorten a capped wait
+	policy = &RetryPolicy{Backoff: "exponential", MaxWait: Timeout(150 * time.Millisecond), Jitter: 0.5}
+	shortened := false
+	for range 100 {
+		wait := policy.wait(4, base)
+		if wait < 75*time.Millisecond || wait > 150*time.Millisecond {
+			log.Fatalf("Unexpected wait with jitter and maximum: %s", wait)
+		}
+		shortened = shortened || wait < 150*time.Millisecond
+	}
+	if !shortened {
+		log.Fatalf("Jitter did not vary the capped wait")
+	}
+}
+
+func TestRetryValidation(t *testing.T) {
+	tests := []struct {
+		bundle  string
+		failure string
+	}{
+		{"retry:\n  backoff: exponential\nchecks:\n  - address: localhost:80\n    protocol: tcp\n    retry:\n      backoff: linear\n", ""},
+		{"retry:\n  backoff: fibonacci\nchecks:\n  - address: localhost:80\n    protocol: tcp\n", "unsupported backoff strategy: 'fibonacci'"},
+		{"checks:\n  - address: localhost:80\n    protocol: tcp\n    retry:\n      backoff: Exponential\n", "unsupported backoff strategy: 'Exponential'"},
+		{"retry:\n  retry_on: [timeout, connection_refused]\n  no_retry_on: [hostname_mismatch]\nchecks:\n  - address: localhost:80\n    protocol: tcp\n", ""},
+		{"retry:\n  retry_on: [timeouts]\nchecks:\n  - address: localhost:80\n    protocol: tcp\n", "unknown error class in retry_on: 'timeouts'"},
+		{"checks:\n  - address: localhost:80\n    protocol: tcp\n    retry:\n      no_retry_on: [certificate_expiry]\n", "unknown error class in no_retry_on: 'certificate_expiry'"},
+	}
+
+	for i, test := range tests {
+		path := filepath.Join(t.TempDir(), "bundle.yaml")
+		if err := os.WriteFile(path, []byte(test.bundle), 0o600); err != nil {
+			log.Fatalf("Could not write bundle in test %d: %v", i, err)
+		}
+		_, err := New(path)
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && (err == nil || !strings.Contains(err.Error(), test.failure)):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		}
+	}
+}
+
+func TestRetryOn(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start TCP server: %v", err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		bundle   *RetryPolicy
+		check    *RetryPolicy
+		attempts int
+	}{
+		{nil, nil, 3},
+		{&RetryPolicy{RetryOn: []ErrorClass{ClassConnectionRefused}}, nil, 3},
+		{&RetryPolicy{RetryOn: []ErrorClass{ClassTimeout}}, nil, 1},
+		{&RetryPolicy{NoRetryOn: []ErrorClass{ClassConnectionRefused}}, nil, 1},
+		{&RetryPolicy{NoRetryOn: []ErrorClass{ClassConnectionRefused}}, &RetryPolicy{NoRetryOn: []ErrorClass{}}, 3},
+		{nil, &RetryPolicy{NoRetryOn: []ErrorClass{ClassConnectionRefused}}, 1},
+	}
+
+	for i, test := range tests {
+		bundle := &Bundle{
+			Timeout:     Timeout(time.Second),
+			Retries:     3,
+			Wait:        Timeout(time.Millisecond),
+			Concurrency: 1,
+			Retry:       test.bundle,
+			Checks:      []Check{{Address: closed.Addr().String(), Protocol: TCP, Retry: test.check}},
+		}
+		bundle.Check()
+		if result := bundle.Checks[0].Result; !result.IsError() || len(result.History) != test.attempts {
+			log.Fatalf("Unexpected attempts in test %d: expected %d, got %+v", i, test.attempts, result.History)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package checks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHOptions contains the settings of SSH checks: how to verify the server's
+// host key and, optionally, how to authenticate and which command to run.
+type SSHOptions struct {
+	// KnownHosts is the path to a known_hosts file the host key is verified
+	// against.
+	KnownHosts string `json:"known_hosts,omitempty" yaml:"known_hosts,omitempty"`
+	// Fingerprints lists the accepted host key fingerprints, in the SHA256
+	// format printed by ssh-keygen (e.g. "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8").
+	Fingerprints []string `json:"fingerprints,omitempty" yaml:"fingerprints,omitempty"`
+	// User is the user to authenticate as; authentication is only attempted
+	// if a key or the agent are configured.
+	User string `json:"user,omitempty" yaml:"user,omitempty"`
+	// KeyFile is the path to the private key used to authenticate.
+	KeyFile string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	// PassphraseEnv is the name of the variable holding the passphrase of the
+	// private key, if encrypted.
+	PassphraseEnv string `json:"passphrase_env,omitempty" yaml:"passphrase_env,omitempty"`
+	// Agent is whether to authenticate with the keys in the SSH agent
+	// listening on SSH_AUTH_SOCK.
+	Agent bool `json:"agent,omitempty" yaml:"agent,omitempty"`
+	// Command is the command to run once authenticated.
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	// Expect contains the assertions on the outcome of the command.
+	Expect *SSHExpect `json:"expect,omitempty" yaml:"expect,omitempty"`
+}
+
+// SSHExpect contains the assertions on the outcome of a command run over SSH.
+type SSHExpect struct {
+	// ExitCode is the expected exit code of the command (0 by default).
+	ExitCode int `json:"exit_code,omitempty" yaml:"exit_code,omitempty"`
+	// Contains is a string the output of the command must contain.
+	Contains string `json:"contains,omitempty" yaml:"contains,omitempty"`
+	// Matches is a regular expression the output of the command must match.
+	Matches string `json:"matches,omitempty" yaml:"matches,omitempty"`
+}
+
+// SSHResult contains the details collected in an SSH check.
+type SSHResult struct {
+	// Banner is the version string sent by the server (e.g. "SSH-2.0-OpenSSH_9.6").
+	Banner string `json:"banner,omitempty" yaml:"banner,omitempty"`
+	// HostKeyType is the type of the server's host key (e.g. "ssh-ed25519").
+	HostKeyType string `json:"host_key_type,omitempty" yaml:"host_key_type,omitempty"`
+	// Fingerprint is the SHA256 fingerprint of the server's host key.
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	// Authenticated is whether the check logged into the server with the
+	// configured credentials.
+	Authenticated bool `json:"authenticated" yaml:"authenticated"`
+	// NoAuthRequired is whether the server let the check log in without any
+	// credentials (the "none" authentication method).
+	NoAuthRequired bool `json:"no_auth_required,omitempty" yaml:"no_auth_required,omitempty"`
+	// ExitCode is the exit code of the command, if any was run.
+	ExitCode *int `json:"exit_code,omitempty" yaml:"exit_code,omitempty"`
+	// Output is the combined standard output and error of the command.
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// versionConn is a connection that records the version line sent by the
+// server at the beginning of the SSH handshake.
+type versionConn struct {
+	net.Conn
+	version bytes.Buffer
+	done    bool
+}
+
+// Read reads from the connection, recording the first line received.
+func (c *versionConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if !c.done {
+		if i := bytes.IndexByte(p[:n], '\n'); i >= 0 {
+			c.version.Write(p[:i])
+			c.done = true
+		} else {
+			c.version.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// doSSH opens an SSH connection to the check's address, verifying the host
+// key if so configured; if credentials are configured, it authenticates and
+// runs the optional command, otherwise the server rejecting the anonymous
+// login is considered healthy.
+func (c *Check) doSSH() error {
+	options := c.SSH
+	if options == nil {
+		options = &SSHOptions{}
+	}
+	address := c.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+
+	c.Result.SSH = &SSHResult{}
+	callback, err := options.hostKeyCallback(c.Result.SSH)
+	if err != nil {
+		slog.Error("error preparing host key verification", "address", address, "error", err)
+		return fmt.Errorf("error preparing host key verification for %s: %w", address, err)
+	}
+	var used bool
+	methods, release, err := options.authMethods(&used)
+	if err != nil {
+		slog.Error("error preparing SSH authentication", "address", address, "error", err)
+		return fmt.Errorf("error preparing SSH authentication for %s: %w", address, err)
+	}
+	defer release()
+	authenticate := len(methods) > 0
+
+	config := &ssh.ClientConfig{
+		User:            options.User,
+		Auth:            methods,
+		HostKeyCallback: callback,
+		Timeout:         time.Duration(c.Timeout),
+	}
+	conn, err := net.DialTimeout("tcp", address, time.Duration(c.Timeout))
+	if err != nil {
+		slog.Error("error dialling", "address", address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error dialling %s on protocol %s: %w", address, c.Protocol.String(), err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(time.Duration(c.Timeout))); err != nil {
+		return fmt.Errorf("error setting deadline on connection to %s: %w", address, err)
+	}
+
+	sniffer := &versionConn{Conn: conn}
+	handshake, channels, requests, err := ssh.NewClientConn(sniffer, address, config)
+	c.Result.SSH.Banner = strings.TrimSpace(sniffer.version.String())
+	if err != nil {
+		if !authenticate && strings.Contains(err.Error(), "ssh: unable to authenticate") {
+			// the handshake and the host key verification succeeded
+			slog.Info("successfully tested connection", "address", address, "protocol", c.Protocol.String(), "banner", c.Result.SSH.Banner)
+			return c.auditSSH(address)
+		}
+		slog.Error("error running ssh session", "address", address, "protocol", c.Protocol.String(), "error", err, "type", fmt.Sprintf("%T", errors.Unwrap(err)))
+		return fmt.Errorf("error opening SSH session to %s: %w", address, err)
+	}
+	client := ssh.NewClient(handshake, channels, requests)
+	defer client.Close()
+	// the client tries the "none" method first, so the credentials are only
+	// used if the server requires them
+	if used {
+		c.Result.SSH.Authenticated = true
+	} else {
+		slog.Warn("server accepted login without credentials", "address", address, "user", options.User)
+		c.Result.SSH.NoAuthRequired = true
+	}
+
+	if options.Command != "" {
+		if err := c.runSSHCommand(client, options); err != nil {
+			return err
+		}
+	}
+	slog.Info("successfully tested connection", "address", address, "protocol", c.Protocol.String(), "banner", c.Result.SSH.Banner)
+	return c.auditSSH(address)
+}
+
+// runSSHCommand runs the command on the server and verifies its outcome.
+func (c *Check) runSSHCommand(client *ssh.Client, options *SSHOptions) error {
+	session, err := client.NewSession()
+	if err != nil {
+		slog.Error("error opening SSH session", "address", c.Address, "error", err)
+		return fmt.Errorf("error opening SSH session to %s: %w", c.Address, err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(options.Command)
+	code := 0
+	if err != nil {
+		var exitErr *ssh.ExitError
+		if !errors.As(err, &exitErr) {
+			slog.Error("error running command", "address", c.Address, "command", options.Command, "error", err)
+			return fmt.Errorf("error running command '%s' on %s: %w", options.Command, c.Address, err)
+		}
+		code = exitErr.ExitStatus()
+	}
+	c.Result.SSH.ExitCode = &code
+	c.Result.SSH.Output = string(output)
+
+	expect := options.Expect
+	if expect == nil {
+		expect = &SSHExpect{}
+	}
+	if code != expect.ExitCode {
+		slog.Error("unexpected exit code", "address", c.Address, "command", options.Command, "exit code", code)
+		return withClass(ClassAssertionFailed, fmt.Errorf("command '%s' on %s exited with code %d, expected %d", options.Command, c.Address, code, expect.ExitCode))
+	}
+	if expect.Contains != "" && !strings.Contains(string(output), expect.Contains) {
+		return withClass(ClassAssertionFailed, fmt.Errorf("output of command '%s' on %s does not contain '%s'", options.Command, c.Address, expect.Contains))
+	}
+	if expect.Matches != "" {
+		re, err := regexp.Compile(expect.Matches)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression '%s': %w", expect.Matches, err)
+		}
+		if !re.Match(output) {
+			return withClass(ClassAssertionFailed, fmt.Errorf("output of command '%s' on %s does not match '%s'", options.Command, c.Address, expect.Matches))
+		}
+	}
+	return nil
+}
+
+// hostKeyCallback returns the callback verifying the server's host key against
+// the known hosts file and the fingerprints, if any, and recording its details
+// in the result.
+func (o *SSHOptions) hostKeyCallback(result *SSHResult) (ssh.HostKeyCallback, error) {
+	var known ssh.HostKeyCallback
+	if o.KnownHosts != "" {
+		path := o.KnownHosts
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(home, rest)
+		}
+		var err error
+		if known, err = knownhosts.New(filepath.Clean(path)); err != nil {
+			return nil, fmt.Errorf("error loading known hosts file: %w", err)
+		}
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		result.HostKeyType = key.Type()
+		result.Fingerprint = ssh.FingerprintSHA256(key)
+		if known != nil {
+			if err := known(hostname, remote, key); err != nil {
+				return withClass(ClassAssertionFailed, err)
+			}
+		}
+		if len(o.Fingerprints) > 0 && !slices.Contains(o.Fingerprints, result.Fingerprint) {
+			return withClass(ClassAssertionFailed, fmt.Errorf("host key fingerprint %s does not match any of the expected ones", result.Fingerprint))
+		}
+		return nil
+	}, nil
+}
+
+// authMethods returns the configured authentication methods, which set used
+// when the client resorts to them, along with a function releasing the
+// connection to the agent, if any.
+func (o *SSHOptions) authMethods(used *bool) ([]ssh.AuthMethod, func(), error) {
+	methods := []ssh.AuthMethod{}
+	release := func() {}
+	record := func(signers func() ([]ssh.Signer, error)) ssh.AuthMethod {
+		return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			*used = true
+			return signers()
+		})
+	}
+	if o.KeyFile != "" {
+		data, err := os.ReadFile(filepath.Clean(o.KeyFile))
+		if err != nil {
+			return nil, release, fmt.Errorf("error reading private key: %w", err)
+		}
+		var signer ssh.Signer
+		if o.PassphraseEnv != "" {
+			passphrase, ok := os.LookupEnv(o.PassphraseEnv)
+			if !ok {
+				return nil, release, fmt.Errorf("environment variable '%s' with key passphrase is not set", o.PassphraseEnv)
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(data)
+		}
+		if err != nil {
+			return nil, release, fmt.Errorf("error parsing private key: %w", err)
+		}
+		methods = append(methods, record(func() ([]ssh.Signer, error) {
+			return []ssh.Signer{signer}, nil
+		}))
+	}
+	if o.Agent {
+		socket, ok := os.LookupEnv("SSH_AUTH_SOCK")
+		if !ok {
+			return nil, release, errors.New("environment variable 'SSH_AUTH_SOCK' with SSH agent socket is not set")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, release, fmt.Errorf("error connecting to SSH agent: %w", err)
+		}
+		release = func() { conn.Close() }
+		methods = append(methods, record(agent.NewClient(conn).Signers))
+	}
+	return methods, release, nil
+}
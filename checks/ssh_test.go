@@ -0,0 +1,209 @@
+package checks
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newTestSSHKey generates an Ed25519 key, returning the signer and the
+// private key in OpenSSH PEM format.
+func newTestSSHKey() (ssh.Signer, ed25519.PrivateKey, []byte) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		log.Fatalf("Could not generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		log.Fatalf("Could not create signer: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		log.Fatalf("Could not marshal key: %v", err)
+	}
+	return signer, key, pem.EncodeToMemory(block)
+}
+
+// startSSHServer starts an SSH server with the given host key, accepting the
+// given client key for user "automation" (or any login, if open) and running
+// the "echo hello" and "false" commands.
+func startSSHServer(hostKey ssh.Signer, authorized ssh.PublicKey, open bool) (string, func()) {
+	config := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-NetcheckTest_1.0",
+		NoClientAuth:  open,
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == "automation" && string(key.Marshal()) == string(authorized.Marshal()) {
+				return &ssh.Permissions{}, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start SSH server: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, channels, requests, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(requests)
+				for request := range channels {
+					channel, requests, err := request.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer channel.Close()
+						for request := range requests {
+							if request.Type != "exec" {
+								_ = request.Reply(false, nil)
+								continue
+							}
+							var payload struct{ Command string }
+							_ = ssh.Unmarshal(request.Payload, &payload)
+							_ = request.Reply(true, nil)
+							status := uint32(0)
+							switch payload.Command {
+							case "echo hello":
+								_, _ = channel.Write([]byte("hello\n"))
+							case "false":
+								status = 1
+							default:
+								_, _ = channel.Stderr().Write([]byte("command not found\n"))
+								status = 127
+							}
+							_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+							return
+						}
+					}()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func TestSSH(t *testing.T) {
+	hostKey, _, _ := newTestSSHKey()
+	otherKey, _, _ := newTestSSHKey()
+	clientKey, clientPrivate, clientPEM := newTestSSHKey()
+	_, _, unauthorizedPEM := newTestSSHKey()
+	address, stop := startSSHServer(hostKey, clientKey.PublicKey(), false)
+	defer stop()
+	open, stop := startSSHServer(hostKey, clientKey.PublicKey(), true)
+	defer stop()
+
+	directory := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(directory, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			log.Fatalf("Could not write %s: %v", name, err)
+		}
+		return path
+	}
+	known := write("known_hosts", []byte(knownhosts.Line([]string{knownhosts.Normalize(address)}, hostKey.PublicKey())+"\n"))
+	changed := write("known_hosts_changed", []byte(knownhosts.Line([]string{knownhosts.Normalize(address)}, otherKey.PublicKey())+"\n"))
+	unknown := write("known_hosts_empty", []byte{})
+	key := write("id_ed25519", clientPEM)
+	unauthorized := write("id_unauthorized", unauthorizedPEM)
+
+	// an agent holding the client key
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: clientPrivate}); err != nil {
+		log.Fatalf("Could not add key to agent: %v", err)
+	}
+	socket := filepath.Join(directory, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		log.Fatalf("Could not start SSH agent: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+
+	fingerprint := ssh.FingerprintSHA256(hostKey.PublicKey())
+
+	tests := []struct {
+		address string
+		options *SSHOptions
+		failure string
+	}{
+		{address, nil, ""},
+		{address, &SSHOptions{KnownHosts: known}, ""},
+		{address, &SSHOptions{KnownHosts: changed}, "key mismatch"},
+		{address, &SSHOptions{KnownHosts: unknown}, "key is unknown"},
+		{address, &SSHOptions{Fingerprints: []string{"SHA256:invalid", fingerprint}}, ""},
+		{address, &SSHOptions{Fingerprints: []string{ssh.FingerprintSHA256(otherKey.PublicKey())}}, "does not match any of the expected ones"},
+		{address, &SSHOptions{KnownHosts: filepath.Join(directory, "missing")}, "error loading known hosts file"},
+		{address, &SSHOptions{KnownHosts: known, User: "automation", KeyFile: key}, ""},
+		{address, &SSHOptions{KnownHosts: known, User: "automation", KeyFile: unauthorized}, "unable to authenticate"},
+		{address, &SSHOptions{KnownHosts: known, User: "automation", Agent: true}, ""},
+		{address, &SSHOptions{KnownHosts: known, User: "automation", KeyFile: key, Command: "echo hello", Expect: &SSHExpect{Contains: "hello"}}, ""},
+		{address, &SSHOptions{KnownHosts: known, User: "automation", Agent: true, Command: "echo hello", Expect: &SSHExpect{Matches: `^hello\n$`}}, ""},
+		{address, &SSHOptions{KnownHosts: known, User: "automation", KeyFile: key, Command: "echo hello", Expect: &SSHExpect{Contains: "goodbye"}}, "does not contain 'goodbye'"},
+		{address, &SSHOptions{KnownHosts: known, User: "automation", KeyFile: key, Command: "false"}, "exited with code 1, expected 0"},
+		{address, &SSHOptions{KnownHosts: known, User: "automation", KeyFile: key, Command: "false", Expect: &SSHExpect{ExitCode: 1}}, ""},
+		{address, &SSHOptions{KnownHosts: known, User: "automation", KeyFile: key, Command: "reboot", Expect: &SSHExpect{ExitCode: 127, Contains: "not found"}}, ""},
+		{address, &SSHOptions{User: "automation", KeyFile: key, PassphraseEnv: "NETCHECK_TEST_MISSING_PASSPHRASE"}, "is not set"},
+		{open, nil, ""},
+		{open, &SSHOptions{Fingerprints: []string{fingerprint}, User: "automation", KeyFile: key, Command: "echo hello", Expect: &SSHExpect{Contains: "hello"}}, ""},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  test.address,
+			Protocol: SSH,
+			Timeout:  Timeout(2 * time.Second),
+			SSH:      test.options,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		case test.failure == "" && (check.Result.SSH.Banner != "SSH-2.0-NetcheckTest_1.0" || check.Result.SSH.Fingerprint != fingerprint || check.Result.SSH.HostKeyType != "ssh-ed25519"):
+			log.Fatalf("Unexpected SSH details in test %d: %+v", i, check.Result.SSH)
+		case test.failure == "" && test.options != nil && test.options.Command != "" && check.Result.SSH.ExitCode == nil:
+			log.Fatalf("Exit code not recorded in test %d", i)
+		case test.failure == "" && check.Result.SSH.NoAuthRequired != (test.address == open):
+			log.Fatalf("Unexpected login without credentials in test %d: %+v", i, check.Result.SSH)
+		case test.failure == "" && check.Result.SSH.Authenticated != (test.address == address && test.options != nil && (test.options.KeyFile != "" || test.options.Agent)):
+			log.Fatalf("Unexpected authentication in test %d: %+v", i, check.Result.SSH)
+		}
+	}
+}
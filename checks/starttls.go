@@ -0,0 +1,178 @@
+package checks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// startTLS performs the protocol-specific negotiation that upgrades a plain
+// text connection to TLS; once it returns successfully, the TLS handshake can
+// start on the connection.
+func startTLS(conn net.Conn, protocol string) error {
+	reader := bufio.NewReader(conn)
+	switch strings.ToLower(protocol) {
+	case "smtp":
+		if _, err := readReply(reader, "220"); err != nil {
+			return fmt.Errorf("unexpected SMTP greeting: %w", err)
+		}
+		if _, err := io.WriteString(conn, "EHLO netcheck\r\n"); err != nil {
+			return err
+		}
+		reply, err := readReply(reader, "250")
+		if err != nil {
+			return fmt.Errorf("unexpected response to SMTP EHLO: %w", err)
+		}
+		if !strings.Contains(strings.ToUpper(reply), "STARTTLS") {
+			return withClass(ClassProtocol, errors.New("SMTP server does not advertise STARTTLS"))
+		}
+		if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+			return err
+		}
+		if _, err := readReply(reader, "220"); err != nil {
+			return fmt.Errorf("unexpected response to SMTP STARTTLS: %w", err)
+		}
+	case "imap":
+		if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "* OK") {
+			return withClass(ClassProtocol, fmt.Errorf("unexpected IMAP greeting: %q", line))
+		}
+		if _, err := io.WriteString(conn, "a001 STARTTLS\r\n"); err != nil {
+			return err
+		}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("error reading response to IMAP STARTTLS: %w", err)
+			}
+			if strings.HasPrefix(line, "a001 ") {
+				if !strings.HasPrefix(line, "a001 OK") {
+					return withClass(ClassProtocol, fmt.Errorf("unexpected response to IMAP STARTTLS: %q", strings.TrimSpace(line)))
+				}
+				break
+			}
+		}
+	case "pop3":
+		if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "+OK") {
+			return withClass(ClassProtocol, fmt.Errorf("unexpected POP3 greeting: %q", line))
+		}
+		if _, err := io.WriteString(conn, "STLS\r\n"); err != nil {
+			return err
+		}
+		if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "+OK") {
+			return withClass(ClassProtocol, fmt.Errorf("unexpected response to POP3 STLS: %q", strings.TrimSpace(line)))
+		}
+	case "ftp":
+		if _, err := readReply(reader, "220"); err != nil {
+			return fmt.Errorf("unexpected FTP greeting: %w", err)
+		}
+		if _, err := io.WriteString(conn, "AUTH TLS\r\n"); err != nil {
+			return err
+		}
+		if _, err := readReply(reader, "234"); err != nil {
+			return fmt.Errorf("unexpected response to FTP AUTH TLS: %w", err)
+		}
+	case "ldap":
+		// StartTLS extended request (RFC 4511, section 4.14.1) with message ID 1
+		oid := "1.3.6.1.4.1.1466.20037"
+		request := []byte{0x30, byte(len(oid) + 7), 0x02, 0x01, 0x01, 0x77, byte(len(oid) + 2), 0x80, byte(len(oid))}
+		request = append(request, oid...)
+		if _, err := conn.Write(request); err != nil {
+			return err
+		}
+		message, err := readBER(reader)
+		if err != nil {
+			return fmt.Errorf("error reading LDAP response: %w", err)
+		}
+		// skip the message ID, then look for the result code in the extended response
+		if len(message) < 3 || message[0] != 0x02 || len(message) < 2+int(message[1]) {
+			return withClass(ClassProtocol, errors.New("malformed LDAP response"))
+		}
+		response := message[2+int(message[1]):]
+		if len(response) < 2 || response[0] != 0x78 {
+			return withClass(ClassProtocol, errors.New("LDAP response is not an extended response"))
+		}
+		result, err := readBER(bufio.NewReader(bytes.NewReader(response)))
+		if err != nil || len(result) < 3 || result[0] != 0x0a {
+			return withClass(ClassProtocol, errors.New("malformed LDAP extended response"))
+		}
+		if code := result[2]; code != 0 {
+			return withClass(ClassProtocol, fmt.Errorf("LDAP server refused StartTLS with result code %d", code))
+		}
+	case "postgres", "postgresql":
+		// SSLRequest message: length and magic request code
+		request := make([]byte, 8)
+		binary.BigEndian.PutUint32(request[0:], 8)
+		binary.BigEndian.PutUint32(request[4:], 80877103)
+		if _, err := conn.Write(request); err != nil {
+			return err
+		}
+		answer, err := reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("error reading response to PostgreSQL SSLRequest: %w", err)
+		}
+		if answer != 'S' {
+			return withClass(ClassProtocol, errors.New("PostgreSQL server does not support SSL"))
+		}
+	default:
+		return fmt.Errorf("unsupported STARTTLS protocol: '%s'", protocol)
+	}
+	if reader.Buffered() > 0 {
+		return withClass(ClassProtocol, errors.New("unexpected data received before TLS handshake"))
+	}
+	return nil
+}
+
+// readReply reads a possibly multi-line reply in the SMTP/FTP format (e.g.
+// "250-first line" ... "250 last line") and verifies its code.
+func readReply(reader *bufio.Reader, code string) (string, error) {
+	var reply strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		reply.WriteString(line)
+		if err != nil {
+			return reply.String(), err
+		}
+		if !strings.HasPrefix(line, code) {
+			return reply.String(), withClass(ClassProtocol, fmt.Errorf("expected code %s, got %q", code, strings.TrimSpace(line)))
+		}
+		if len(line) > 3 && line[3] == ' ' {
+			return reply.String(), nil
+		}
+	}
+}
+
+// readBER reads a BER encoded element and returns its content.
+func readBER(reader *bufio.Reader) ([]byte, error) {
+	if _, err := reader.ReadByte(); err != nil {
+		return nil, err
+	}
+	length, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	size := int(length)
+	if length&0x80 != 0 {
+		count := int(length & 0x7f)
+		if count == 0 || count > 4 {
+			return nil, errors.New("unsupported BER length")
+		}
+		size = 0
+		for range count {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			size = size<<8 | int(b)
+		}
+	}
+	content := make([]byte, size)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
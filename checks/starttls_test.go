@@ -0,0 +1,196 @@
+package checks
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+)
+
+// bufferedConn is a connection whose reads go through a buffered reader.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// startSTARTTLSServer starts a server that runs the given plain text
+// negotiation, then upgrades the connection to TLS if it succeeds.
+func startSTARTTLSServer(config *tls.Config, negotiate func(conn net.Conn, reader *bufio.Reader) bool) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start STARTTLS server: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				if negotiate(conn, reader) {
+					_ = tls.Server(&bufferedConn{conn, reader}, config).Handshake()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+// exchange reads a line from the client and, if it starts with the given
+// command, sends the response back.
+func exchange(conn net.Conn, reader *bufio.Reader, command string, response string) bool {
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, command) {
+		return false
+	}
+	_, err = io.WriteString(conn, response)
+	return err == nil
+}
+
+func TestStartTLS(t *testing.T) {
+	ca := newTestCA("Test Root CA")
+	server := newTestServerCertificate(ca, time.Time{})
+	config := serverConfig(server)
+
+	servers := map[string]func(conn net.Conn, reader *bufio.Reader) bool{
+		"smtp": func(conn net.Conn, reader *bufio.Reader) bool {
+			_, _ = io.WriteString(conn, "220-mail.example.com ESMTP\r\n220 ready\r\n")
+			return exchange(conn, reader, "EHLO", "250-mail.example.com\r\n250-STARTTLS\r\n250 SIZE 1024\r\n") &&
+				exchange(conn, reader, "STARTTLS", "220 go ahead\r\n")
+		},
+		"smtp-no-starttls": func(conn net.Conn, reader *bufio.Reader) bool {
+			_, _ = io.WriteString(conn, "220 mail.example.com ESMTP\r\n")
+			return exchange(conn, reader, "EHLO", "250 mail.example.com\r\n")
+		},
+		"imap": func(conn net.Conn, reader *bufio.Reader) bool {
+			_, _ = io.WriteString(conn, "* OK IMAP4rev1 ready\r\n")
+			return exchange(conn, reader, "a001 STARTTLS", "* informational line\r\na001 OK begin TLS\r\n")
+		},
+		"pop3": func(conn net.Conn, reader *bufio.Reader) bool {
+			_, _ = io.WriteString(conn, "+OK POP3 ready\r\n")
+			return exchange(conn, reader, "STLS", "+OK begin TLS\r\n")
+		},
+		"ftp": func(conn net.Conn, reader *bufio.Reader) bool {
+			_, _ = io.WriteString(conn, "220 FTP ready\r\n")
+			return exchange(conn, reader, "AUTH TLS", "234 AUTH TLS ok\r\n")
+		},
+		"ftp-refused": func(conn net.Conn, reader *bufio.Reader) bool {
+			_, _ = io.WriteString(conn, "220 FTP ready\r\n")
+			exchange(conn, reader, "AUTH TLS", "502 not implemented\r\n")
+			return false
+		},
+		"ldap": func(conn net.Conn, reader *bufio.Reader) bool {
+			request, err := readBER(reader)
+			if err != nil || !strings.Contains(string(request), "1.3.6.1.4.1.1466.20037") {
+				return false
+			}
+			// extended response with message ID 1 and result code success
+			_, err = conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+			return err == nil
+		},
+		"ldap-refused": func(conn net.Conn, reader *bufio.Reader) bool {
+			if _, err := readBER(reader); err != nil {
+				return false
+			}
+			// extended response with message ID 1 and result code protocolError
+			_, _ = conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x02, 0x04, 0x00, 0x04, 0x00})
+			return false
+		},
+		"postgres": func(conn net.Conn, reader *bufio.Reader) bool {
+			request := make([]byte, 8)
+			if _, err := io.ReadFull(reader, request); err != nil || string(request) != "\x00\x00\x00\x08\x04\xd2\x16\x2f" {
+				return false
+			}
+			_, err := conn.Write([]byte{'S'})
+			return err == nil
+		},
+		"smtp-slow": func(conn net.Conn, reader *bufio.Reader) bool {
+			time.Sleep(300 * time.Millisecond)
+			_, _ = io.WriteString(conn, "220 mail.example.com ESMTP\r\n")
+			ok := exchange(conn, reader, "EHLO", "250-mail.example.com\r\n250 STARTTLS\r\n") &&
+				exchange(conn, reader, "STARTTLS", "220 go ahead\r\n")
+			time.Sleep(300 * time.Millisecond)
+			return ok
+		},
+		"postgres-no-ssl": func(conn net.Conn, reader *bufio.Reader) bool {
+			request := make([]byte, 8)
+			_, _ = io.ReadFull(reader, request)
+			_, _ = conn.Write([]byte{'N'})
+			return false
+		},
+	}
+	addresses := map[string]string{}
+	for name, negotiate := range servers {
+		address, stop := startSTARTTLSServer(config, negotiate)
+		defer stop()
+		addresses[name] = address
+	}
+
+	tests := []struct {
+		server   string
+		starttls string
+		failure  string
+	}{
+		{"smtp", "smtp", ""},
+		{"imap", "imap", ""},
+		{"pop3", "pop3", ""},
+		{"ftp", "ftp", ""},
+		{"ldap", "ldap", ""},
+		{"postgres", "postgres", ""},
+		{"postgres", "postgresql", ""},
+		{"smtp-no-starttls", "smtp", "does not advertise STARTTLS"},
+		{"ftp-refused", "ftp", "expected code 234"},
+		{"ldap-refused", "ldap", "result code 2"},
+		{"postgres-no-ssl", "postgres", "does not support SSL"},
+		{"smtp", "imap", "unexpected IMAP greeting"},
+		{"smtp", "xmpp", "unsupported STARTTLS protocol"},
+	}
+
+	for _, test := range tests {
+		check := &Check{
+			Address:  addresses[test.server],
+			Protocol: TLS,
+			Timeout:  Timeout(2 * time.Second),
+			TLS:      &tlsconfig.Options{CA: ca.CertPEM},
+			StartTLS: test.starttls,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error with %s on %s server: %v", test.starttls, test.server, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error with %s on %s server, got none", test.starttls, test.server)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error with %s on %s server: expected '%s', got '%v'", test.starttls, test.server, test.failure, err)
+		case test.failure == "" && (check.Result.TLS == nil || check.Result.TLS.Certificates[0].Subject != "CN=localhost"):
+			log.Fatalf("Unexpected TLS details with %s: %+v", test.starttls, check.Result.TLS)
+		}
+	}
+
+	// each phase has its own timeout, so a slow negotiation followed by a
+	// slow handshake succeeds as long as each of them completes in time
+	for _, timeout := range []time.Duration{500 * time.Millisecond, 200 * time.Millisecond} {
+		check := &Check{
+			Address:  addresses["smtp-slow"],
+			Protocol: TLS,
+			Timeout:  Timeout(timeout),
+			TLS:      &tlsconfig.Options{CA: ca.CertPEM},
+			StartTLS: "smtp",
+		}
+		if err := check.Do(); (err != nil) != (timeout < 300*time.Millisecond) {
+			log.Fatalf("Unexpected outcome with slow STARTTLS server and timeout %s: %v", timeout, err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing contains the timings of a check: when it started, how long it took
+// and, for the protocols running over TCP, how long each phase of the
+// connection took in the last attempt.
+type Timing struct {
+	// Start is when the first attempt started.
+	Start time.Time `json:"start" yaml:"start"`
+	// Duration is the time taken by the last attempt.
+	Duration Timeout `json:"duration" yaml:"duration"`
+	// Total is the time taken by all the attempts, including the waits
+	// between them.
+	Total Timeout `json:"total,omitempty" yaml:"total,omitempty"`
+	// Attempts is the number of attempts performed.
+	Attempts int `json:"attempts" yaml:"attempts"`
+	// DNS is the time taken to resolve the host name.
+	DNS Timeout `json:"dns,omitempty" yaml:"dns,omitempty"`
+	// Connect is the time taken to open the TCP connection.
+	Connect Timeout `json:"connect,omitempty" yaml:"connect,omitempty"`
+	// TLS is the time taken by the TLS handshake.
+	TLS Timeout `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// FirstByte is the time from the start of the attempt to the first byte
+	// of the HTTP response.
+	FirstByte Timeout `json:"first_byte,omitempty" yaml:"first_byte,omitempty"`
+
+	// the trace callbacks may run concurrently (e.g. when dialling IPv4 and
+	// IPv6 addresses in parallel), and even after the attempt is over (e.g.
+	// a connection dialled in the background by a shared HTTP transport), in
+	// which case they are ignored
+	mu           sync.Mutex
+	done         bool
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+}
+
+// Attempt is the outcome of an attempt at performing a check.
+type Attempt struct {
+	// Start is when the attempt started.
+	Start time.Time `json:"start" yaml:"start"`
+	// Duration is the time taken by the attempt.
+	Duration Timeout `json:"duration" yaml:"duration"`
+	// Status is the outcome of the attempt.
+	Status Status `json:"status" yaml:"status"`
+	// Class is the class of the error, or of the warning, of the attempt.
+	Class ErrorClass `json:"class,omitempty" yaml:"class,omitempty"`
+	// Message is the error, or the warning, of the attempt.
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// newAttempt returns the outcome of the attempt that produced the given
+// result and error.
+func newAttempt(r Result, err error) Attempt {
+	r.err = err
+	attempt := Attempt{
+		Status: r.Status(),
+		Class:  r.Class(),
+	}
+	if r.Timing != nil {
+		attempt.Start = r.Timing.Start
+		attempt.Duration = r.Timing.Duration
+	}
+	if attempt.Status != Success {
+		attempt.Message = r.String()
+	}
+	return attempt
+}
+
+// String returns a one-line representation of the attempt.
+func (a Attempt) String() string {
+	outcome := a.Status.String()
+	if a.Class != "" {
+		outcome += " (" + string(a.Class) + ")"
+	}
+	return fmt.Sprintf("%s %10s %s", a.Start.Format("15:04:05.000"), a.Duration.String(), outcome)
+}
+
+// MaxLatency contains the thresholds on the duration of a check, above which
+// a check that succeeded is turned into a warning or a failure.
+type MaxLatency struct {
+	// Warning is the duration above which the check causes a warning.
+	Warning Timeout `json:"warning,omitempty" yaml:"warning,omitempty"`
+	// Critical is the duration above which the check fails.
+	Critical Timeout `json:"critical,omitempty" yaml:"critical,omitempty"`
+}
+
+// trace returns a context recording the duration of the DNS lookup, of the
+// TCP connection, of the TLS handshake and the time to the first byte of
+// the response of the dials and HTTP requests performed with it; only the
+// first occurrence of each phase is recorded.
+func (t *Timing) trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.done {
+				return
+			}
+			if t.dnsStart.IsZero() {
+				t.dnsStart = time.Now()
+			}
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.done {
+				return
+			}
+			if t.DNS == 0 && !t.dnsStart.IsZero() {
+				t.DNS = Timeout(time.Since(t.dnsStart))
+			}
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.done {
+				return
+			}
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_ string, _ string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.done {
+				return
+			}
+			if err == nil && t.Connect == 0 {
+				t.Connect = Timeout(time.Since(t.connectStart))
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.done {
+				return
+			}
+			if t.tlsStart.IsZero() {
+				t.tlsStart = time.Now()
+			}
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.done {
+				return
+			}
+			if t.TLS == 0 && !t.tlsStart.IsZero() {
+				t.TLS = Timeout(time.Since(t.tlsStart))
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.done {
+				return
+			}
+			if t.FirstByte == 0 {
+				t.FirstByte = Timeout(time.Since(t.Start))
+			}
+		},
+	})
+}
+
+// seal stops recording the timings of the attempt, ignoring any callback
+// still running, and returns a copy of the timings for the result.
+func (t *Timing) seal() *Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done = true
+	return &Timing{
+		Start:     t.Start,
+		Duration:  Timeout(time.Since(t.Start)),
+		Total:     t.Total,
+		Attempts:  t.Attempts,
+		DNS:       t.DNS,
+		Connect:   t.Connect,
+		TLS:       t.TLS,
+		FirstByte: t.FirstByte,
+	}
+}
+
+// recordTLS records the duration of the TLS handshake started at the given
+// time, unless the attempt is over.
+func (t *Timing) recordTLS(start time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.done {
+		t.TLS = Timeout(time.Since(start))
+	}
+}
+
+// verifyLatency turns a successful check whose last attempt took longer than
+// the thresholds into a failure, or into a success with a warning.
+func (c *Check) verifyLatency() error {
+	if c.MaxLatency == nil {
+		return nil
+	}
+	duration := c.Result.Timing.Duration
+	if c.MaxLatency.Critical > 0 && duration > c.MaxLatency.Critical {
+		slog.Error("check exceeded critical latency", "address", c.Address, "protocol", c.Protocol.String(), "duration", duration, "threshold", c.MaxLatency.Critical)
+		return withClass(ClassLatency, fmt.Errorf("check of host %s on protocol %s took %s, above %s", c.Address, c.Protocol.String(), duration, c.MaxLatency.Critical))
+	}
+	if c.MaxLatency.Warning > 0 && duration > c.MaxLatency.Warning && c.Result.warning == nil {
+		slog.Warn("check exceeded warning latency", "address", c.Address, "protocol", c.Protocol.String(), "duration", duration, "threshold", c.MaxLatency.Warning)
+		c.Result.warning = withClass(ClassLatency, fmt.Errorf("check of host %s on protocol %s took %s, above %s", c.Address, c.Protocol.String(), duration, c.MaxLatency.Warning))
+	}
+	return nil
+}
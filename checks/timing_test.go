@@ -0,0 +1,171 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+)
+
+func TestTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+	ca := newTestCA("Test Root CA")
+	secure, stop := startTLSServer(serverConfig(newTestServerCertificate(ca, time.Time{})))
+	defer stop()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+
+	tests := []struct {
+		check *Check
+		dns   bool
+		tls   bool
+		ttfb  bool
+	}{
+		{&Check{Address: "localhost:" + port, Protocol: TCP}, true, false, false},
+		{&Check{Address: secure, Protocol: TLS, TLS: &tlsconfig.Options{CA: ca.CertPEM}}, false, true, false},
+		{&Check{Address: "localhost:" + port, Protocol: HTTP}, true, false, true},
+	}
+
+	for i, test := range tests {
+		test.check.Timeout = Timeout(2 * time.Second)
+		if err := test.check.Do(); err != nil {
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		}
+		timing := test.check.Result.Timing
+		switch {
+		case timing == nil || timing.Start.IsZero() || timing.Duration <= 0 || timing.Attempts != 1:
+			log.Fatalf("Unexpected timing in test %d: %+v", i, timing)
+		case timing.Connect <= 0 || timing.Connect > timing.Duration:
+			log.Fatalf("Unexpected connection time in test %d: %+v", i, timing)
+		case test.dns != (timing.DNS > 0):
+			log.Fatalf("Unexpected DNS lookup time in test %d: %+v", i, timing)
+		case test.tls != (timing.TLS > 0):
+			log.Fatalf("Unexpected TLS handshake time in test %d: %+v", i, timing)
+		case test.ttfb != (timing.FirstByte >= Timeout(50*time.Millisecond)):
+			log.Fatalf("Unexpected time to first byte in test %d: %+v", i, timing)
+		}
+	}
+}
+
+func TestTimingSeal(t *testing.T) {
+	timing := &Timing{Start: time.Now(), Attempts: 1}
+	trace := httptrace.ContextClientTrace(timing.trace(context.Background()))
+	trace.ConnectStart("tcp", "127.0.0.1:80")
+	trace.ConnectDone("tcp", "127.0.0.1:80", nil)
+	sealed := timing.seal()
+
+	// callbacks running after the attempt is over are ignored
+	trace.TLSHandshakeStart()
+	trace.TLSHandshakeDone(tls.ConnectionState{}, nil)
+	trace.GotFirstResponseByte()
+	if sealed == timing || sealed.Connect <= 0 || sealed.Duration <= 0 || sealed.TLS != 0 || timing.TLS != 0 || timing.FirstByte != 0 {
+		log.Fatalf("Unexpected timing after sealing: %+v", sealed)
+	}
+}
+
+func TestMaxLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		latency *MaxLatency
+		status  Status
+	}{
+		{nil, Success},
+		{&MaxLatency{Warning: Timeout(time.Second), Critical: Timeout(2 * time.Second)}, Success},
+		{&MaxLatency{Warning: Timeout(10 * time.Millisecond)}, Warning},
+		{&MaxLatency{Warning: Timeout(10 * time.Millisecond), Critical: Timeout(20 * time.Millisecond)}, Failure},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:    strings.TrimPrefix(server.URL, "http://"),
+			Protocol:   HTTP,
+			Timeout:    Timeout(2 * time.Second),
+			MaxLatency: test.latency,
+		}
+		check.Result.err = check.Do()
+		if check.Result.Status() != test.status {
+			log.Fatalf("Unexpected status in test %d: expected %v, got %v (%s)", i, test.status, check.Result.Status(), check.Result.String())
+		}
+		if test.status != Success && check.Result.Class() != ClassLatency {
+			log.Fatalf("Unexpected class in test %d: %s", i, check.Result.Class())
+		}
+	}
+
+	// the attempts are counted and timed as a whole
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start TCP server: %v", err)
+	}
+	closed.Close()
+	bundle := &Bundle{
+		Timeout:     Timeout(time.Second),
+		Retries:     3,
+		Wait:        Timeout(10 * time.Millisecond),
+		Concurrency: 1,
+		Checks:      []Check{{Address: closed.Addr().String(), Protocol: TCP}},
+	}
+	bundle.Check()
+	timing := bundle.Checks[0].Result.Timing
+	if timing == nil || timing.Attempts != 3 || timing.Total < Timeout(20*time.Millisecond) || timing.Total < timing.Duration {
+		log.Fatalf("Unexpected timing of retried check: %+v", timing)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	bundle := &Bundle{
+		Timeout:     Timeout(time.Second),
+		Retries:     5,
+		Wait:        Timeout(time.Millisecond),
+		Concurrency: 1,
+		Checks:      []Check{{Address: address, Protocol: HTTP}},
+	}
+	bundle.Check()
+	result := bundle.Checks[0].Result
+	if result.IsError() || !result.IsFlaky() || len(result.History) != 3 || result.Timing.Attempts != 3 {
+		log.Fatalf("Unexpected result of flaky check: %s, %+v", result.String(), result.History)
+	}
+	for i, attempt := range result.History {
+		expected := Failure
+		if i == 2 {
+			expected = Success
+		}
+		if attempt.Status != expected || attempt.Start.IsZero() || attempt.Duration <= 0 || (expected == Failure) != (attempt.Class == ClassAssertionFailed) {
+			log.Fatalf("Unexpected attempt %d: %+v", i, attempt)
+		}
+	}
+	data, _ := json.Marshal(bundle.Checks[0])
+	if !strings.Contains(string(data), `"flaky":true`) || !strings.Contains(string(data), `"history":[`) {
+		log.Fatalf("History not in JSON result: %s", data)
+	}
+
+	// checks passing at the first attempt are not flaky
+	bundle.Check()
+	if result := bundle.Checks[0].Result; result.IsFlaky() || len(result.History) != 1 {
+		log.Fatalf("Unexpected result of stable check: %s, %+v", result.String(), result.History)
+	}
+}
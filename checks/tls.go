@@ -0,0 +1,320 @@
+package checks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+)
+
+// doTLS performs a TLS handshake with the check's address, after upgrading
+// the connection with STARTTLS if so configured, then verifies the hostname
+// and the expiry of the certificate.
+func (c *Check) doTLS() error {
+	config, err := tlsconfig.New(c.TLS, hostname(c.Address))
+	if err != nil {
+		slog.Error("error preparing TLS configuration", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error preparing TLS configuration for %s: %w", c.Address, err)
+	}
+
+	conn, err := c.dialTLS(context.Background(), c.Address, config, c.Result.Timing)
+	if err != nil {
+		slog.Error("error dialling", "address", c.Address, "protocol", c.Protocol.String(), "starttls", c.StartTLS, "error", err)
+		return fmt.Errorf("error dialling %s on protocol %s: %w", c.Address, c.Protocol.String(), err)
+	}
+	defer conn.Close()
+	c.Result.TLS = newTLSResult(conn.ConnectionState())
+	if err := c.verifyPeer(verifiedChain(conn.ConnectionState()), config); err != nil {
+		return err
+	}
+	return c.auditTLS(c.Address)
+}
+
+// dialTLS opens a TLS connection to the given address, upgrading it with
+// STARTTLS first if so configured, and performs the handshake; each phase
+// (the connection, the STARTTLS negotiation and the handshake) must complete
+// within the check's timeout, and all of them before the deadline of the
+// given context, if any. If timing is not nil, the duration of each phase is
+// recorded in it.
+func (c *Check) dialTLS(parent context.Context, address string, config *tls.Config, timing *Timing) (*tls.Conn, error) {
+	ctx, cancel := context.WithTimeout(parent, time.Duration(c.Timeout))
+	defer cancel()
+	if timing != nil {
+		ctx = timing.trace(ctx)
+	}
+	var dialer net.Dialer
+	plain, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if c.StartTLS != "" {
+		deadline := time.Now().Add(time.Duration(c.Timeout))
+		if limit, ok := parent.Deadline(); ok && limit.Before(deadline) {
+			deadline = limit
+		}
+		if err := plain.SetDeadline(deadline); err != nil {
+			plain.Close()
+			return nil, err
+		}
+		if err := startTLS(plain, c.StartTLS); err != nil {
+			plain.Close()
+			return nil, fmt.Errorf("error negotiating STARTTLS (%s): %w", c.StartTLS, err)
+		}
+		if err := plain.SetDeadline(time.Time{}); err != nil {
+			plain.Close()
+			return nil, err
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(parent, time.Duration(c.Timeout))
+	defer cancel()
+	start := time.Now()
+	conn := tls.Client(plain, config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		plain.Close()
+		if c.StartTLS != "" {
+			return nil, fmt.Errorf("error performing TLS handshake after STARTTLS: %w", err)
+		}
+		return nil, err
+	}
+	if timing != nil {
+		timing.recordTLS(start)
+	}
+	return conn, nil
+}
+
+// verifyPeer checks the certificate chain presented by the server after the
+// handshake: the hostname (unless verification is disabled), the expiry of
+// the certificates and the expectations on the server identity.
+func (c *Check) verifyPeer(chain []*x509.Certificate, config *tls.Config) error {
+	if !config.InsecureSkipVerify && len(chain) > 0 {
+		err := chain[0].VerifyHostname(config.ServerName)
+		if err != nil {
+			slog.Error("hostname does not match certificate", "hostname", config.ServerName, "error", err)
+			return fmt.Errorf("hostname mismatch in certificate from host %s on protocol %s: %w", c.Address, c.Protocol.String(), err)
+		}
+	}
+	if err := c.verifyExpiry(chain); err != nil {
+		return err
+	}
+	if c.Certificate != nil {
+		if err := c.Certificate.verify(chain); err != nil {
+			slog.Error("unexpected certificate", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+			return withClass(ClassAssertionFailed, fmt.Errorf("unexpected certificate from host %s on protocol %s: %w", c.Address, c.Protocol.String(), err))
+		}
+	}
+	if len(chain) > 0 {
+		slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "certificate issuer", chain[0].Issuer, "certificate expiry", chain[0].NotAfter.Format(time.RFC3339))
+	} else {
+		slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String())
+	}
+	return nil
+}
+
+// verifiedChain returns the certificate chain built when verifying the
+// certificate of the server, which may differ from the certificates it sent
+// (e.g. extra cross-signed certificates that are not part of the chain); if
+// verification was disabled, it returns the certificates sent by the server.
+func verifiedChain(state tls.ConnectionState) []*x509.Certificate {
+	if len(state.VerifiedChains) > 0 {
+		return state.VerifiedChains[0]
+	}
+	return state.PeerCertificates
+}
+
+// expiringFormat is the format of the message of certificates expiring within
+// the critical or warning threshold: subject, address, protocol, expiry and
+// threshold.
+const expiringFormat = "certificate %s from host %s on protocol %s expires on %s, within %s"
+
+// verifyExpiry checks the expiry of every certificate in the given chain: an
+// expired certificate, or one expiring within the critical threshold, fails
+// the check, whereas one expiring within the warning threshold is recorded as
+// a warning in the result.
+func (c *Check) verifyExpiry(chain []*x509.Certificate) error {
+	now := time.Now()
+	for _, certificate := range chain {
+		expiry := certificate.NotAfter
+		subject := certificate.Subject.String()
+		if now.After(expiry) {
+			slog.Error("certificate has expired", "subject", subject, "expiry", expiry.Format(time.RFC3339))
+			return withClass(ClassCertificateExpired, fmt.Errorf("certificate %s from host %s on protocol %s expired on %s", subject, c.Address, c.Protocol.String(), expiry.Format(time.RFC3339)))
+		}
+		if c.ExpiryCritical > 0 && now.Add(time.Duration(c.ExpiryCritical)).After(expiry) {
+			slog.Error("certificate expires within critical threshold", "subject", subject, "expiry", expiry.Format(time.RFC3339), "threshold", c.ExpiryCritical)
+			return withClass(ClassCertificateExpiring, fmt.Errorf(expiringFormat, subject, c.Address, c.Protocol.String(), expiry.Format(time.RFC3339), c.ExpiryCritical))
+		}
+		if c.ExpiryWarning > 0 && now.Add(time.Duration(c.ExpiryWarning)).After(expiry) && c.Result.warning == nil {
+			slog.Warn("certificate expires within warning threshold", "subject", subject, "expiry", expiry.Format(time.RFC3339), "threshold", c.ExpiryWarning)
+			c.Result.warning = withClass(ClassCertificateExpiring, fmt.Errorf(expiringFormat, subject, c.Address, c.Protocol.String(), expiry.Format(time.RFC3339), c.ExpiryWarning))
+		}
+	}
+	return nil
+}
+
+// hostname returns the host part of an address in the host:port form.
+func hostname(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
+// CertificateExpect contains the assertions on the identity of the certificate
+// presented by the server, which are verified after the TLS handshake.
+type CertificateExpect struct {
+	// Fingerprints lists the accepted SHA-256 fingerprints of the leaf
+	// certificate, hex encoded (colons are allowed).
+	Fingerprints []string `json:"fingerprints,omitempty" yaml:"fingerprints,omitempty"`
+	// SPKIPins lists the accepted SHA-256 pins of the subject public key info,
+	// base64 encoded as in HPKP; at least one certificate in the chain must
+	// match one of them.
+	SPKIPins []string `json:"spki_pins,omitempty" yaml:"spki_pins,omitempty"`
+	// IssuerCN is the expected common name of the issuer of the leaf.
+	IssuerCN string `json:"issuer_cn,omitempty" yaml:"issuer_cn,omitempty"`
+	// SANs lists the subject alternative names the leaf must contain.
+	SANs []string `json:"sans,omitempty" yaml:"sans,omitempty"`
+	// KeyAlgorithm is the expected public key algorithm of the leaf, one of
+	// RSA, ECDSA and Ed25519.
+	KeyAlgorithm string `json:"key_algorithm,omitempty" yaml:"key_algorithm,omitempty"`
+}
+
+// verify checks the certificate chain against the expectations, returning
+// an error describing the first one that is not met.
+func (e *CertificateExpect) verify(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("no certificate presented")
+	}
+	leaf := newCertificate(chain[0])
+
+	if len(e.Fingerprints) > 0 {
+		found := slices.ContainsFunc(e.Fingerprints, func(fingerprint string) bool {
+			return strings.EqualFold(strings.ReplaceAll(fingerprint, ":", ""), leaf.Fingerprint)
+		})
+		if !found {
+			return fmt.Errorf("fingerprint %s does not match any of the expected ones", leaf.Fingerprint)
+		}
+	}
+
+	if len(e.SPKIPins) > 0 {
+		found := false
+		for _, certificate := range chain {
+			digest := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+			if slices.Contains(e.SPKIPins, base64.StdEncoding.EncodeToString(digest[:])) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("no certificate in the chain matches the expected SPKI pins")
+		}
+	}
+
+	if e.IssuerCN != "" && chain[0].Issuer.CommonName != e.IssuerCN {
+		return fmt.Errorf("issuer common name '%s' does not match '%s'", chain[0].Issuer.CommonName, e.IssuerCN)
+	}
+
+	for _, san := range e.SANs {
+		if !slices.ContainsFunc(leaf.SANs, func(value string) bool { return strings.EqualFold(value, san) }) {
+			return fmt.Errorf("subject alternative name %s is missing", san)
+		}
+	}
+
+	if e.KeyAlgorithm != "" && !strings.EqualFold(leaf.KeyType, e.KeyAlgorithm) {
+		return fmt.Errorf("key algorithm %s does not match %s", leaf.KeyType, e.KeyAlgorithm)
+	}
+	return nil
+}
+
+// TLSResult contains the details of a TLS session and of the certificates
+// presented by the server.
+type TLSResult struct {
+	// Version is the negotiated TLS version.
+	Version string `json:"version" yaml:"version"`
+	// CipherSuite is the negotiated cipher suite.
+	CipherSuite string `json:"cipher_suite" yaml:"cipher_suite"`
+	// ALPN is the negotiated application protocol, if any.
+	ALPN string `json:"alpn,omitempty" yaml:"alpn,omitempty"`
+	// Certificates is the chain of certificates presented by the server,
+	// leaf first.
+	Certificates []Certificate `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+}
+
+// Certificate contains the details of an X.509 certificate.
+type Certificate struct {
+	Subject            string    `json:"subject" yaml:"subject"`
+	SANs               []string  `json:"sans,omitempty" yaml:"sans,omitempty"`
+	Issuer             string    `json:"issuer" yaml:"issuer"`
+	Serial             string    `json:"serial" yaml:"serial"`
+	NotBefore          time.Time `json:"not_before" yaml:"not_before"`
+	NotAfter           time.Time `json:"not_after" yaml:"not_after"`
+	KeyType            string    `json:"key_type" yaml:"key_type"`
+	KeySize            int       `json:"key_size" yaml:"key_size"`
+	SignatureAlgorithm string    `json:"signature_algorithm" yaml:"signature_algorithm"`
+	Fingerprint        string    `json:"fingerprint" yaml:"fingerprint"` // SHA-256, hex encoded
+}
+
+// newTLSResult collects the details of the given TLS session.
+func newTLSResult(state tls.ConnectionState) *TLSResult {
+	result := &TLSResult{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+	}
+	for _, certificate := range state.PeerCertificates {
+		result.Certificates = append(result.Certificates, newCertificate(certificate))
+	}
+	return result
+}
+
+// newCertificate collects the details of the given certificate.
+func newCertificate(certificate *x509.Certificate) Certificate {
+	sans := []string{}
+	sans = append(sans, certificate.DNSNames...)
+	for _, ip := range certificate.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, certificate.EmailAddresses...)
+	for _, uri := range certificate.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	keyType, keySize := "unknown", 0
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		keyType, keySize = "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		keyType, keySize = "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		keyType, keySize = "Ed25519", 256
+	}
+
+	fingerprint := sha256.Sum256(certificate.Raw)
+	return Certificate{
+		Subject:            certificate.Subject.String(),
+		SANs:               sans,
+		Issuer:             certificate.Issuer.String(),
+		Serial:             certificate.SerialNumber.Text(16),
+		NotBefore:          certificate.NotBefore,
+		NotAfter:           certificate.NotAfter,
+		KeyType:            keyType,
+		KeySize:            keySize,
+		SignatureAlgorithm: certificate.SignatureAlgorithm.String(),
+		Fingerprint:        hex.EncodeToString(fingerprint[:]),
+	}
+}
@@ -0,0 +1,322 @@
+package checks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/netcheck/tlsconfig"
+)
+
+// testCertificate is a certificate with its private key, both in PEM format.
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	CertPEM     string
+	KeyPEM      string
+}
+
+// newTestCertificate creates a certificate from the given template, signed
+// by the given parent or self-signed if the parent is nil.
+func newTestCertificate(template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatalf("Could not generate key: %v", err)
+	}
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(365 * 24 * time.Hour)
+	}
+	signer, issuer := key, template
+	if parent != nil {
+		signer, issuer = parent.key, parent.certificate
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		log.Fatalf("Could not create certificate: %v", err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	data, _ := x509.MarshalECPrivateKey(key)
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		CertPEM:     string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		KeyPEM:      string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: data})),
+	}
+}
+
+// newTestCA creates a self-signed certification authority.
+func newTestCA(name string) *testCertificate {
+	return newTestCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, nil)
+}
+
+// newTestServerCertificate creates a server certificate for localhost, signed
+// by the given CA.
+func newTestServerCertificate(ca *testCertificate, notAfter time.Time) *testCertificate {
+	return newTestCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost", "server.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+}
+
+// startTLSServer starts a TLS server presenting the given certificate chain,
+// which accepts connections and closes them right after the handshake.
+func startTLSServer(config *tls.Config) (string, func()) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		log.Fatalf("Could not start TLS server: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+// serverConfig returns the server TLS configuration presenting the given
+// certificate along with its issuers.
+func serverConfig(leaf *testCertificate, chain ...*testCertificate) *tls.Config {
+	pair, err := tls.X509KeyPair([]byte(leaf.CertPEM), []byte(leaf.KeyPEM))
+	if err != nil {
+		log.Fatalf("Could not load server key pair: %v", err)
+	}
+	for _, c := range chain {
+		pair.Certificate = append(pair.Certificate, c.certificate.Raw)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{pair}}
+}
+
+func TestTLSOptions(t *testing.T) {
+	ca := newTestCA("Test Root CA")
+	server := newTestServerCertificate(ca, time.Time{})
+	client := newTestCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "netcheck"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.certificate)
+	config := serverConfig(server)
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	config.ClientCAs = pool
+	address, stop := startTLSServer(config)
+	defer stop()
+
+	tests := []struct {
+		options *tlsconfig.Options
+		failure string
+	}{
+		{nil, "certificate signed by unknown authority"},
+		{&tlsconfig.Options{CA: ca.CertPEM, Cert: client.CertPEM, Key: client.KeyPEM}, ""},
+		{&tlsconfig.Options{CA: ca.CertPEM, Cert: client.CertPEM, Key: client.KeyPEM, ServerName: "server.example.com"}, ""},
+		{&tlsconfig.Options{CA: ca.CertPEM, Cert: client.CertPEM, Key: client.KeyPEM, ServerName: "other.example.com"}, "other.example.com"},
+		{&tlsconfig.Options{Insecure: true, Cert: client.CertPEM, Key: client.KeyPEM}, ""},
+		{&tlsconfig.Options{CA: ca.CertPEM, Cert: client.CertPEM}, "both client certificate and key"},
+		{&tlsconfig.Options{CA: ca.CertPEM, Cert: client.CertPEM, Key: client.KeyPEM, MinVersion: "1.4"}, "invalid min_version: unsupported TLS version: '1.4'"},
+		{&tlsconfig.Options{CA: ca.CertPEM, Cert: client.CertPEM, Key: client.KeyPEM, MaxVersion: "1.1"}, "max_version '1.1' (TLS 1.1) is lower than min_version (TLS 1.2)"},
+		{&tlsconfig.Options{CA: "/path/to/missing/ca.pem"}, "error loading CA bundle"},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  address,
+			Protocol: TLS,
+			Timeout:  Timeout(2 * time.Second),
+			TLS:      test.options,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		}
+	}
+}
+
+func TestTLSExpiry(t *testing.T) {
+	ca := newTestCA("Test Root CA")
+	intermediate := newTestCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		NotAfter:              time.Now().Add(20 * 24 * time.Hour),
+	}, ca)
+	server := newTestServerCertificate(intermediate, time.Now().Add(10*24*time.Hour))
+
+	address, stop := startTLSServer(serverConfig(server, intermediate))
+	defer stop()
+
+	tests := []struct {
+		warning  string
+		critical string
+		status   Status
+		subject  string
+	}{
+		{"", "", Success, ""},
+		{"5d", "1d", Success, ""},
+		{"15d", "1d", Warning, "CN=localhost"},
+		{"30d", "15d", Failure, "CN=localhost"},
+		{"30d", "1d12h", Warning, "CN=localhost"},
+		{"", "15d", Failure, "CN=localhost"},
+	}
+
+	for _, test := range tests {
+		check := &Check{
+			Address:  address,
+			Protocol: TLS,
+			Timeout:  Timeout(2 * time.Second),
+			TLS:      &tlsconfig.Options{CA: ca.CertPEM},
+		}
+		if test.warning != "" {
+			if err := check.ExpiryWarning.UnmarshalText([]byte(test.warning)); err != nil {
+				log.Fatalf("Could not parse warning threshold %s: %v", test.warning, err)
+			}
+		}
+		if test.critical != "" {
+			if err := check.ExpiryCritical.UnmarshalText([]byte(test.critical)); err != nil {
+				log.Fatalf("Could not parse critical threshold %s: %v", test.critical, err)
+			}
+		}
+		check.Result.err = check.Do()
+		if check.Result.Status() != test.status {
+			log.Fatalf("Unexpected status with thresholds %s/%s: expected %v, got %v (%s)", test.warning, test.critical, test.status, check.Result.Status(), check.Result.String())
+		}
+		if !strings.Contains(check.Result.String(), test.subject) {
+			log.Fatalf("Result does not mention certificate %s: %s", test.subject, check.Result.String())
+		}
+	}
+
+	// the whole chain is verified, not only the leaf certificate
+	address, stop = startTLSServer(serverConfig(newTestServerCertificate(intermediate, time.Time{}), intermediate))
+	defer stop()
+	check := &Check{
+		Address:       address,
+		Protocol:      TLS,
+		Timeout:       Timeout(2 * time.Second),
+		TLS:           &tlsconfig.Options{CA: ca.CertPEM},
+		ExpiryWarning: Timeout(25 * 24 * time.Hour),
+	}
+	check.Result.err = check.Do()
+	if !check.Result.IsWarning() || !strings.Contains(check.Result.String(), "Test Intermediate CA") {
+		log.Fatalf("Expected warning on intermediate certificate, got %v", check.Result.String())
+	}
+	data, _ := json.Marshal(check)
+	if !strings.Contains(string(data), `"status":"warning"`) {
+		log.Fatalf("Status not in JSON result: %s", data)
+	}
+
+	// extra certificates sent by the server but not part of the verified
+	// chain (e.g. an expired cross-signed root) are ignored, unless the
+	// certificate is not verified
+	cross := newTestCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Expired Cross-Signed CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(-24 * time.Hour),
+	}, newTestCA("Test Old Root CA"))
+	address, stop = startTLSServer(serverConfig(newTestServerCertificate(ca, time.Time{}), cross))
+	defer stop()
+	for _, insecure := range []bool{false, true} {
+		check := &Check{
+			Address:  address,
+			Protocol: TLS,
+			Timeout:  Timeout(2 * time.Second),
+			TLS:      &tlsconfig.Options{CA: ca.CertPEM, Insecure: insecure},
+		}
+		check.Result.err = check.Do()
+		if insecure != check.Result.IsError() || (insecure && check.Result.Class() != ClassCertificateExpired) {
+			log.Fatalf("Unexpected result with extra expired certificate (insecure: %t): %s", insecure, check.Result.String())
+		}
+	}
+}
+
+func TestTLSCertificateExpect(t *testing.T) {
+	ca := newTestCA("Test Root CA")
+	server := newTestServerCertificate(ca, time.Time{})
+	address, stop := startTLSServer(serverConfig(server, ca))
+	defer stop()
+
+	fingerprint := sha256.Sum256(server.certificate.Raw)
+	leafPin := sha256.Sum256(server.certificate.RawSubjectPublicKeyInfo)
+	caPin := sha256.Sum256(ca.certificate.RawSubjectPublicKeyInfo)
+
+	tests := []struct {
+		expect  *CertificateExpect
+		failure string
+	}{
+		{&CertificateExpect{Fingerprints: []string{hex.EncodeToString(fingerprint[:])}}, ""},
+		{&CertificateExpect{Fingerprints: []string{strings.ToUpper(hex.EncodeToString(fingerprint[:2])) + ":" + hex.EncodeToString(fingerprint[2:])}}, ""},
+		{&CertificateExpect{Fingerprints: []string{strings.Repeat("00", 32)}}, "does not match any of the expected ones"},
+		{&CertificateExpect{SPKIPins: []string{base64.StdEncoding.EncodeToString(leafPin[:])}}, ""},
+		{&CertificateExpect{SPKIPins: []string{"invalid", base64.StdEncoding.EncodeToString(caPin[:])}}, ""},
+		{&CertificateExpect{SPKIPins: []string{"invalid"}}, "SPKI pins"},
+		{&CertificateExpect{IssuerCN: "Test Root CA"}, ""},
+		{&CertificateExpect{IssuerCN: "Other CA"}, "issuer common name"},
+		{&CertificateExpect{SANs: []string{"server.example.com", "127.0.0.1"}}, ""},
+		{&CertificateExpect{SANs: []string{"www.example.com"}}, "www.example.com is missing"},
+		{&CertificateExpect{KeyAlgorithm: "ecdsa"}, ""},
+		{&CertificateExpect{KeyAlgorithm: "RSA"}, "key algorithm ECDSA"},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:     address,
+			Protocol:    TLS,
+			Timeout:     Timeout(2 * time.Second),
+			TLS:         &tlsconfig.Options{CA: ca.CertPEM},
+			Certificate: test.expect,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		}
+	}
+}
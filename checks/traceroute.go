@@ -0,0 +1,411 @@
+package checks
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// DefaultTraceMaxHops is the maximum number of hops traced, unless
+	// otherwise specified.
+	DefaultTraceMaxHops = 30
+	// DefaultTraceUDPPort is the destination port of the first UDP probe;
+	// each hop uses the next one, as in the classic traceroute.
+	DefaultTraceUDPPort = 33434
+	// traceMaxSilentHops is the number of consecutive hops not replying after
+	// which the trace is abandoned.
+	traceMaxSilentHops = 5
+)
+
+// TraceOptions contains the settings of traceroutes, both in traceroute
+// checks and when tracing the route to the host of a failed check.
+type TraceOptions struct {
+	// Method is the kind of probe sent: "icmp" (echo requests, the default),
+	// "udp" (datagrams to unlikely ports) or "tcp" (connection attempts).
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+	// MaxHops is the maximum number of hops traced (30 by default).
+	MaxHops int `json:"max_hops,omitempty" yaml:"max_hops,omitempty"`
+	// Port is the destination port of UDP (33434 and following by default) and
+	// TCP probes (the port in the address, or 80, by default).
+	Port int `json:"port,omitempty" yaml:"port,omitempty"`
+	// Timeout is how long to wait for the reply of each hop (1s by default).
+	Timeout Timeout `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// TraceResult contains the route to a host.
+type TraceResult struct {
+	// Method is the kind of probe sent.
+	Method string `json:"method" yaml:"method"`
+	// Destination is the IP address the host resolved to.
+	Destination string `json:"destination" yaml:"destination"`
+	// Reached is whether the destination replied.
+	Reached bool `json:"reached" yaml:"reached"`
+	// Hops lists the hops along the route, the last one being the destination
+	// if reached.
+	Hops []Hop `json:"hops" yaml:"hops"`
+}
+
+// Hop is a router along the route to a host.
+type Hop struct {
+	// TTL is the time to live of the probe the hop replied to.
+	TTL int `json:"ttl" yaml:"ttl"`
+	// Address is the address of the hop, or empty if it did not reply.
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+	// RTT is the round trip time to the hop.
+	RTT Timeout `json:"rtt,omitempty" yaml:"rtt,omitempty"`
+}
+
+// String returns a representation of the hop similar to traceroute's.
+func (h Hop) String() string {
+	if h.Address == "" {
+		return fmt.Sprintf("%2d  *", h.TTL)
+	}
+	return fmt.Sprintf("%2d  %s  %s", h.TTL, h.Address, time.Duration(h.RTT).Round(10*time.Microsecond))
+}
+
+// doTraceroute traces the route to the check's address and fails unless the
+// destination is reached.
+func (c *Check) doTraceroute() error {
+	trace, err := c.trace()
+	c.Result.Trace = trace
+	if err != nil {
+		slog.Error("error tracing route", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error tracing route to %s: %w", c.Address, err)
+	}
+	if !trace.Reached {
+		slog.Error("destination not reached", "address", c.Address, "protocol", c.Protocol.String(), "hops", len(trace.Hops))
+		return withClass(ClassHostUnreachable, fmt.Errorf("destination %s not reached in %d hops", c.Address, len(trace.Hops)))
+	}
+	slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "hops", len(trace.Hops))
+	return nil
+}
+
+// endpoint returns the host and port in the check's address, which can be a
+// URL in HTTP(s) checks; the port defaults to the protocol's.
+func (c *Check) endpoint() (string, int) {
+	switch c.Protocol {
+	case HTTP, HTTPS:
+		if u, err := url.Parse(c.Protocol.String() + "://" + c.Address); err == nil {
+			port, err := strconv.Atoi(u.Port())
+			if err != nil {
+				port = map[Protocol]int{HTTP: 80, HTTPS: 443}[c.Protocol]
+			}
+			return u.Hostname(), port
+		}
+	case SSH:
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return c.Address, 22
+		}
+	}
+	if host, port, err := net.SplitHostPort(c.Address); err == nil {
+		if number, err := strconv.Atoi(port); err == nil {
+			return host, number
+		}
+		return host, 0
+	}
+	return c.Address, 0
+}
+
+// trace traces the route to the host in the check's address.
+func (c *Check) trace() (*TraceResult, error) {
+	options := c.Traceroute
+	if options == nil {
+		options = &TraceOptions{}
+	}
+	method := options.Method
+	if method == "" {
+		method = "icmp"
+	}
+	if method != "icmp" && method != "udp" && method != "tcp" {
+		return nil, fmt.Errorf("unsupported traceroute method: '%s'", method)
+	}
+	maxHops := options.MaxHops
+	if maxHops <= 0 {
+		maxHops = DefaultTraceMaxHops
+	}
+	timeout := time.Duration(options.Timeout)
+	if timeout <= 0 {
+		timeout = time.Duration(DefaultPingTimeout)
+	}
+	host, port := c.endpoint()
+	switch {
+	case options.Port > 0:
+		port = options.Port
+	case method == "udp":
+		port = DefaultTraceUDPPort
+	case port == 0:
+		port = 80
+	}
+
+	ip, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", host, err)
+	}
+	tracer := &tracer{
+		method:  method,
+		target:  ip.IP,
+		port:    port,
+		v4:      ip.IP.To4() != nil,
+		id:      rand.IntN(0xffff),
+		timeout: timeout,
+	}
+	network, address := "ip4:icmp", "0.0.0.0"
+	if !tracer.v4 {
+		network, address = "ip6:ipv6-icmp", "::"
+	}
+	// replies from intermediate hops can only be read from raw ICMP sockets
+	if tracer.conn, err = icmp.ListenPacket(network, address); err != nil {
+		return nil, fmt.Errorf("error opening raw ICMP socket, which requires CAP_NET_RAW or administrator privileges: %w", err)
+	}
+	defer tracer.conn.Close()
+
+	result := &TraceResult{Method: method, Destination: ip.IP.String()}
+	silent := 0
+	for ttl := 1; ttl <= maxHops && silent < traceMaxSilentHops; ttl++ {
+		hop, last, err := tracer.probe(ttl)
+		if err != nil {
+			return result, err
+		}
+		slog.Debug("traced hop", "destination", result.Destination, "hop", hop.String())
+		result.Hops = append(result.Hops, hop)
+		if last {
+			// a router may also reject the probe, as unreachable or prohibited
+			result.Reached = hop.Address == result.Destination
+			break
+		}
+		if hop.Address == "" {
+			silent++
+		} else {
+			silent = 0
+		}
+	}
+	return result, nil
+}
+
+// tracer sends the probes of a traceroute and matches the replies.
+type tracer struct {
+	method  string
+	target  net.IP
+	port    int
+	source  int // source port of the current TCP probe
+	v4      bool
+	id      int
+	timeout time.Duration
+	conn    *icmp.PacketConn
+}
+
+// probe sends a probe with the given TTL and waits for the reply of the hop,
+// returning whether the hop is the last one.
+func (t *tracer) probe(ttl int) (Hop, bool, error) {
+	hop := Hop{TTL: ttl}
+	start := time.Now()
+	deadline := start.Add(t.timeout)
+
+	// connection attempts block, so their outcome is collected asynchronously
+	var connected chan error
+	switch t.method {
+	case "icmp":
+		if err := t.sendEcho(ttl); err != nil {
+			return hop, false, err
+		}
+	case "udp":
+		conn, err := net.Dial("udp", net.JoinHostPort(t.target.String(), strconv.Itoa(t.port+ttl-1)))
+		if err != nil {
+			return hop, false, err
+		}
+		defer conn.Close()
+		if err := t.setTTL(conn, ttl); err != nil {
+			return hop, false, err
+		}
+		if _, err := conn.Write([]byte("netcheck")); err != nil {
+			return hop, false, err
+		}
+	case "tcp":
+		// the source port is chosen beforehand, so that the replies to
+		// this probe can be told apart from those to the previous ones
+		source, err := t.freePort()
+		if err != nil {
+			return hop, false, err
+		}
+		t.source = source
+		connected = make(chan error, 1)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		dialer := &net.Dialer{
+			LocalAddr: &net.TCPAddr{Port: source},
+			Control: func(_, _ string, raw syscall.RawConn) error {
+				var err error
+				if e := raw.Control(func(fd uintptr) { err = setSocketTTL(fd, t.v4, ttl) }); e != nil {
+					return e
+				}
+				return err
+			},
+		}
+		go func() {
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(t.target.String(), strconv.Itoa(t.port)))
+			if err == nil {
+				conn.Close()
+			}
+			connected <- err
+		}()
+	}
+
+	buffer := make([]byte, 1500)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-connected:
+			// either accepted or refused, the destination replied
+			if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+				hop.Address, hop.RTT = t.target.String(), Timeout(time.Since(start))
+				return hop, true, nil
+			}
+			connected = nil
+		default:
+		}
+		// poll, so as to notice connection attempts completing
+		poll := time.Now().Add(20 * time.Millisecond)
+		if poll.After(deadline) {
+			poll = deadline
+		}
+		if err := t.conn.SetReadDeadline(poll); err != nil {
+			return hop, false, err
+		}
+		n, peer, err := t.conn.ReadFrom(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return hop, false, err
+		}
+		if matched, reached := t.match(buffer[:n], ttl); matched {
+			hop.Address, hop.RTT = peer.String(), Timeout(time.Since(start))
+			return hop, reached, nil
+		}
+	}
+	return hop, false, nil
+}
+
+// freePort returns a local TCP port that is not in use.
+func (t *tracer) freePort() (int, error) {
+	address := "127.0.0.1:0"
+	if !t.v4 {
+		address = "[::1]:0"
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// sendEcho sends an ICMP echo request with the given TTL.
+func (t *tracer) sendEcho(ttl int) error {
+	message := icmp.Message{
+		Type: icmpType(t.v4, ipv4.ICMPTypeEcho, ipv6.ICMPTypeEchoRequest),
+		Body: &icmp.Echo{ID: t.id, Seq: ttl, Data: []byte("netcheck")},
+	}
+	data, err := message.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	if t.v4 {
+		err = t.conn.IPv4PacketConn().SetTTL(ttl)
+	} else {
+		err = t.conn.IPv6PacketConn().SetHopLimit(ttl)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.WriteTo(data, &net.IPAddr{IP: t.target})
+	return err
+}
+
+// setTTL sets the TTL of the packets sent over the given connection.
+func (t *tracer) setTTL(conn net.Conn, ttl int) error {
+	if t.v4 {
+		return ipv4.NewConn(conn).SetTTL(ttl)
+	}
+	return ipv6.NewConn(conn).SetHopLimit(ttl)
+}
+
+// match returns whether the ICMP message is a reply to the probe with the
+// given TTL and, if so, whether the trace ends there.
+func (t *tracer) match(data []byte, ttl int) (bool, bool) {
+	protocol := 1
+	if !t.v4 {
+		protocol = 58
+	}
+	message, err := icmp.ParseMessage(protocol, data)
+	if err != nil {
+		return false, false
+	}
+	switch body := message.Body.(type) {
+	case *icmp.Echo:
+		// the destination replied to the echo request
+		reply := icmpType(t.v4, ipv4.ICMPTypeEchoReply, ipv6.ICMPTypeEchoReply)
+		return t.method == "icmp" && message.Type == reply && body.ID == t.id && body.Seq == ttl, true
+	case *icmp.TimeExceeded:
+		return t.matchQuoted(body.Data, ttl), false
+	case *icmp.DstUnreach:
+		// the destination, or a router along the way, rejected the probe
+		return t.matchQuoted(body.Data, ttl), true
+	}
+	return false, false
+}
+
+// matchQuoted returns whether the packet quoted in an ICMP error message is
+// the probe with the given TTL.
+func (t *tracer) matchQuoted(data []byte, ttl int) bool {
+	var protocol int
+	var destination net.IP
+	if t.v4 {
+		if len(data) < 20 {
+			return false
+		}
+		length := int(data[0]&0x0f) * 4
+		if len(data) < length+8 {
+			return false
+		}
+		protocol, destination, data = int(data[9]), net.IP(data[16:20]), data[length:]
+	} else {
+		if len(data) < 48 {
+			return false
+		}
+		protocol, destination, data = int(data[6]), net.IP(data[24:40]), data[40:]
+	}
+	if !destination.Equal(t.target) {
+		return false
+	}
+	switch t.method {
+	case "icmp":
+		return (protocol == 1 || protocol == 58) && int(binary.BigEndian.Uint16(data[4:6])) == t.id && int(binary.BigEndian.Uint16(data[6:8])) == ttl
+	case "udp":
+		return protocol == 17 && int(binary.BigEndian.Uint16(data[2:4])) == t.port+ttl-1
+	case "tcp":
+		return protocol == 6 && int(binary.BigEndian.Uint16(data[0:2])) == t.source && int(binary.BigEndian.Uint16(data[2:4])) == t.port
+	}
+	return false
+}
+
+// icmpType returns the ICMP message type for the IP version.
+func icmpType(v4 bool, ipv4Type ipv4.ICMPType, ipv6Type ipv6.ICMPType) icmp.Type {
+	if v4 {
+		return ipv4Type
+	}
+	return ipv6Type
+}
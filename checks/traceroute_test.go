@@ -0,0 +1,129 @@
+package checks
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceroute(t *testing.T) {
+	if conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0"); err != nil {
+		t.Skipf("raw ICMP sockets unavailable: %v", err)
+	} else {
+		conn.Close()
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start TCP server: %v", err)
+	}
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start TCP server: %v", err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		address string
+		options *TraceOptions
+		failure string
+	}{
+		{"127.0.0.1", nil, ""},
+		{"127.0.0.1", &TraceOptions{Method: "icmp"}, ""},
+		{"127.0.0.1", &TraceOptions{Method: "udp"}, ""},
+		{listener.Addr().String(), &TraceOptions{Method: "tcp"}, ""},
+		{closed.Addr().String(), &TraceOptions{Method: "tcp"}, ""},
+		{"127.0.0.1", &TraceOptions{Method: "sctp"}, "unsupported traceroute method"},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:    test.address,
+			Protocol:   TRACEROUTE,
+			Timeout:    Timeout(2 * time.Second),
+			Traceroute: test.options,
+		}
+		err := check.Do()
+		switch {
+		case test.failure == "" && err != nil:
+			log.Fatalf("Unexpected error in test %d: %v", i, err)
+		case test.failure != "" && err == nil:
+			log.Fatalf("Expected error in test %d, got none", i)
+		case test.failure != "" && !strings.Contains(err.Error(), test.failure):
+			log.Fatalf("Unexpected error in test %d: expected '%s', got '%v'", i, test.failure, err)
+		case test.failure == "" && (!check.Result.Trace.Reached || len(check.Result.Trace.Hops) != 1 || check.Result.Trace.Hops[0].Address != "127.0.0.1"):
+			log.Fatalf("Unexpected route in test %d: %+v", i, check.Result.Trace)
+		}
+	}
+}
+
+func TestTraceOnFailure(t *testing.T) {
+	if conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0"); err != nil {
+		t.Skipf("raw ICMP sockets unavailable: %v", err)
+	} else {
+		conn.Close()
+	}
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start TCP server: %v", err)
+	}
+	closed.Close()
+
+	bundle := &Bundle{
+		Timeout:     Timeout(time.Second),
+		Retries:     1,
+		Wait:        Timeout(time.Millisecond),
+		Concurrency: 2,
+		Checks: []Check{
+			{Address: closed.Addr().String(), Protocol: TCP, TraceOnFailure: true},
+			{Address: closed.Addr().String(), Protocol: TCP},
+		},
+	}
+	bundle.Check()
+	if trace := bundle.Checks[0].Result.Trace; trace == nil || !trace.Reached || len(trace.Hops) != 1 {
+		log.Fatalf("Unexpected route for failed check: %+v", trace)
+	}
+	if bundle.Checks[1].Result.Trace != nil {
+		log.Fatalf("Unexpected route for check without tracing: %+v", bundle.Checks[1].Result.Trace)
+	}
+}
+
+func TestTraceMatchQuoted(t *testing.T) {
+	// quotes an IPv4 header towards 192.0.2.1 followed by the first 8 bytes
+	// of the transport header
+	quote := func(protocol byte, first, second, third, fourth uint16) []byte {
+		data := make([]byte, 28)
+		data[0] = 0x45
+		data[9] = protocol
+		copy(data[16:20], net.ParseIP("192.0.2.1").To4())
+		for i, value := range []uint16{first, second, third, fourth} {
+			binary.BigEndian.PutUint16(data[20+2*i:], value)
+		}
+		return data
+	}
+
+	tests := []struct {
+		tracer  tracer
+		data    []byte
+		ttl     int
+		matched bool
+	}{
+		{tracer{method: "tcp", port: 443, source: 40000}, quote(6, 40000, 443, 0, 0), 5, true},
+		{tracer{method: "tcp", port: 443, source: 40000}, quote(6, 40001, 443, 0, 0), 5, false},
+		{tracer{method: "tcp", port: 443, source: 40000}, quote(6, 40000, 80, 0, 0), 5, false},
+		{tracer{method: "udp", port: 33434}, quote(17, 50000, 33438, 0, 0), 5, true},
+		{tracer{method: "udp", port: 33434}, quote(17, 50000, 33437, 0, 0), 5, false},
+		{tracer{method: "icmp", id: 7}, quote(1, 0x0800, 0, 7, 5), 5, true},
+		{tracer{method: "icmp", id: 7}, quote(1, 0x0800, 0, 7, 4), 5, false},
+	}
+
+	for i, test := range tests {
+		test.tracer.target, test.tracer.v4 = net.ParseIP("192.0.2.1"), true
+		if matched := test.tracer.matchQuoted(test.data, test.ttl); matched != test.matched {
+			log.Fatalf("Unexpected match in test %d: expected %t, got %t", i, test.matched, matched)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package checks
+
+import (
+	"syscall"
+)
+
+// setSocketTTL sets the TTL of the packets sent over the given socket.
+func setSocketTTL(fd uintptr, v4 bool, ttl int) error {
+	if v4 {
+		return syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+	}
+	return syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl)
+}
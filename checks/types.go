@@ -3,15 +3,34 @@ package checks
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Timeout wraps the native time.Duration time, adding JSON, YAML and TOML
-// marshalling/unmarshalling capabilities.
+// marshalling/unmarshalling capabilities; on top of the units supported by
+// time.ParseDuration, it accepts days (e.g. "30d" or "1d12h").
 type Timeout time.Duration
 
+// days matches the days component of a duration.
+var days = regexp.MustCompile(`(\d+(?:\.\d+)?)d`)
+
+// parseDuration parses a duration, converting days to hours beforehand.
+func parseDuration(value string) (time.Duration, error) {
+	value = days.ReplaceAllStringFunc(value, func(match string) string {
+		count, err := strconv.ParseFloat(strings.TrimSuffix(match, "d"), 64)
+		if err != nil {
+			return match
+		}
+		return strconv.FormatFloat(count*24, 'f', -1, 64) + "h"
+	})
+	return time.ParseDuration(value)
+}
+
 // String returns a string representation of the Timeout.
 func (t Timeout) String() string {
 	return time.Duration(t).String()
@@ -28,7 +47,7 @@ func (t *Timeout) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &value); err != nil {
 		return err
 	}
-	d, err := time.ParseDuration(value)
+	d, err := parseDuration(value)
 	if err != nil {
 		return err
 	}
@@ -43,7 +62,7 @@ func (t Timeout) MarshalYAML() (any, error) {
 
 // UnmarshalYAML unmarshals the Timeout struct from YAML.
 func (t *Timeout) UnmarshalYAML(node *yaml.Node) (err error) {
-	d, err := time.ParseDuration(node.Value)
+	d, err := parseDuration(node.Value)
 	if err != nil {
 		return err
 	}
@@ -58,7 +77,7 @@ func (t Timeout) MarshalText() (text []byte, err error) {
 
 // UnmarshalText unmarshals the Timeout struct from text.
 func (t *Timeout) UnmarshalText(text []byte) error {
-	d, err := time.ParseDuration(string(text))
+	d, err := parseDuration(string(text))
 	if err != nil {
 		return err
 	}
@@ -78,11 +97,20 @@ const (
 	SSH
 	HTTP
 	HTTPS
+	DNS
+	BANNER // send/expect over TCP
+	POSTGRES
+	MYSQL
+	REDIS
+	GRPC
+	GRPCS      // gRPC over TLS
+	MTU        // path MTU discovery over ICMP
+	TRACEROUTE // route tracing over ICMP, UDP or TCP
 )
 
 // String returns a string representation of the Protocol.
 func (p Protocol) String() string {
-	return []string{"tcp", "udp", "icmp", "tls", "dtls", "ssh", "http", "https"}[p]
+	return []string{"tcp", "udp", "icmp", "tls", "dtls", "ssh", "http", "https", "dns", "banner", "postgres", "mysql", "redis", "grpc", "grpcs", "mtu", "traceroute"}[p]
 }
 
 // FromString returns the Protocol value corresponding to the given string representation.
@@ -104,6 +132,24 @@ func (p *Protocol) FromString(value string) error {
 		*p = HTTP
 	case "https":
 		*p = HTTPS
+	case "dns":
+		*p = DNS
+	case "banner", "expect":
+		*p = BANNER
+	case "postgres", "postgresql":
+		*p = POSTGRES
+	case "mysql":
+		*p = MYSQL
+	case "redis":
+		*p = REDIS
+	case "grpc":
+		*p = GRPC
+	case "grpcs":
+		*p = GRPCS
+	case "mtu":
+		*p = MTU
+	case "traceroute":
+		*p = TRACEROUTE
 	default:
 		return fmt.Errorf("unsupported value: '%s'", value)
 	}
@@ -144,9 +190,91 @@ func (p *Protocol) UnmarshalText(text []byte) error {
 	return p.FromString(string(text))
 }
 
-// Result represents the result of a check.
+// Status represents the outcome of a check.
+type Status uint8
+
+const (
+	Success Status = iota
+	Warning
+	Failure
+)
+
+// String returns a string representation of the Status.
+func (s Status) String() string {
+	return []string{"success", "warning", "failure"}[s]
+}
+
+// MarshalJSON marshals the Status to JSON.
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// MarshalYAML marshals the Status to YAML.
+func (s Status) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+// MarshalText marshals the Status to text.
+func (s Status) MarshalText() (text []byte, err error) {
+	return []byte(s.String()), nil
+}
+
+// Result represents the result of a check, along with the protocol-specific
+// details collected while performing it; a check that succeeded may still
+// carry a warning (e.g. a certificate that is about to expire).
 type Result struct {
-	err error
+	err     error
+	warning error
+	// Banner contains the greeting and the responses received in a banner
+	// check.
+	Banner *BannerResult `json:"banner,omitempty" yaml:"banner,omitempty"`
+	// Database contains the server version reported in PostgreSQL, MySQL
+	// and Redis checks.
+	Database *DatabaseResult `json:"database,omitempty" yaml:"database,omitempty"`
+	// SSH contains the server banner and host key, and the outcome of the
+	// command run, in SSH checks.
+	SSH *SSHResult `json:"ssh,omitempty" yaml:"ssh,omitempty"`
+	// GRPC contains the serving status reported in gRPC health checks.
+	GRPC *GRPCResult `json:"grpc,omitempty" yaml:"grpc,omitempty"`
+	// Ping contains the packet loss and round trip time statistics of an
+	// ICMP check.
+	Ping *PingResult `json:"ping,omitempty" yaml:"ping,omitempty"`
+	// MTU contains the path MTU discovered in an MTU check.
+	MTU *MTUResult `json:"mtu,omitempty" yaml:"mtu,omitempty"`
+	// Trace contains the route to the host in traceroute checks and, if so
+	// configured, in failed checks.
+	Trace *TraceResult `json:"trace,omitempty" yaml:"trace,omitempty"`
+	// Explanation contains the diagnosis of the layer that failed, in failed
+	// checks with the explain option.
+	Explanation *Explanation `json:"explanation,omitempty" yaml:"explanation,omitempty"`
+	// Timing contains the start time, the duration and the number of
+	// attempts of the check and, for the protocols running over TCP, the
+	// duration of the DNS lookup, TCP connection, TLS handshake and the time
+	// to the first byte of the response.
+	Timing *Timing `json:"timing,omitempty" yaml:"timing,omitempty"`
+	// History lists the outcome of each attempt at performing the check, in
+	// the order they were made.
+	History []Attempt `json:"history,omitempty" yaml:"history,omitempty"`
+	// UDP contains the response received in a UDP check.
+	UDP *UDPResult `json:"udp,omitempty" yaml:"udp,omitempty"`
+	// DNS contains the answers and the resolver RTT of a DNS check.
+	DNS *DNSResult `json:"dns,omitempty" yaml:"dns,omitempty"`
+	// TLS contains the session and certificate details of TLS, DTLS and
+	// HTTPS checks.
+	TLS *TLSResult `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// Audit contains the algorithms, TLS versions and cipher suites accepted
+	// by the server in checks with an audit policy.
+	Audit *AuditResult `json:"audit,omitempty" yaml:"audit,omitempty"`
+}
+
+// Status returns the outcome of the check.
+func (r Result) Status() Status {
+	if r.err != nil {
+		return Failure
+	} else if r.warning != nil {
+		return Warning
+	}
+	return Success
 }
 
 // IsError returns whether the Result represents an error.
@@ -154,20 +282,88 @@ func (r Result) IsError() bool {
 	return r.err != nil
 }
 
+// IsWarning returns whether the Result represents a success with a warning.
+func (r Result) IsWarning() bool {
+	return r.err == nil && r.warning != nil
+}
+
+// Class returns the class of the error, or of the warning, of the Result;
+// it is empty on success.
+func (r Result) Class() ErrorClass {
+	if r.err != nil {
+		return classify(r.err)
+	}
+	return classify(r.warning)
+}
+
+// IsFlaky returns whether the Result represents a success (possibly with a
+// warning) that required more than one attempt.
+func (r Result) IsFlaky() bool {
+	return r.err == nil && len(r.History) > 1
+}
+
 // String returns a string representation of the Result.
 func (r Result) String() string {
 	if r.IsError() {
 		return r.err.Error()
+	} else if r.IsWarning() {
+		return r.warning.Error()
 	}
 	return "success"
 }
 
-// MarshalJSON produces the JSON value for the Result.
+// MarshalJSON produces the JSON value for the Result, i.e. its message; the
+// status and the details are marshalled alongside it by the Check.
 func (r Result) MarshalJSON() ([]byte, error) {
 	return json.Marshal(r.String())
 }
 
-// MarshalYAML returns the YAML value for the Result.
+// MarshalYAML returns the YAML value for the Result, i.e. its message; the
+// status and the details are marshalled alongside it by the Check.
 func (r Result) MarshalYAML() (any, error) {
 	return r.String(), nil
 }
+
+// result is used to marshal the fields of the Result without recursing into
+// its custom marshalling methods.
+type result Result
+
+// details is used to marshal the status and the protocol-specific details of
+// the Result.
+type details Result
+
+// MarshalJSON produces the JSON value for the details of the Result.
+func (d details) MarshalJSON() ([]byte, error) {
+	r := Result(d)
+	return json.Marshal(struct {
+		Status  Status     `json:"status"`
+		Message string     `json:"message"`
+		Class   ErrorClass `json:"class,omitempty"`
+		Flaky   bool       `json:"flaky,omitempty"`
+		result
+	}{
+		Status:  r.Status(),
+		Message: r.String(),
+		Class:   r.Class(),
+		Flaky:   r.IsFlaky(),
+		result:  result(r),
+	})
+}
+
+// MarshalYAML returns the YAML value for the details of the Result.
+func (d details) MarshalYAML() (any, error) {
+	r := Result(d)
+	return struct {
+		Status  Status     `yaml:"status"`
+		Message string     `yaml:"message"`
+		Class   ErrorClass `yaml:"class,omitempty"`
+		Flaky   bool       `yaml:"flaky,omitempty"`
+		result  `yaml:",inline"`
+	}{
+		Status:  r.Status(),
+		Message: r.String(),
+		Class:   r.Class(),
+		Flaky:   r.IsFlaky(),
+		result:  result(r),
+	}, nil
+}
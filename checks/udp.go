@@ -0,0 +1,233 @@
+package checks
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// UDPProbe describes the datagram sent to the server in a UDP check and the
+// response expected back.
+type UDPProbe struct {
+	// Preset is the name of a built-in payload (dns, ntp, snmp, syslog); it
+	// is mutually exclusive with Payload.
+	Preset string `json:"preset,omitempty" yaml:"preset,omitempty"`
+	// Payload is the datagram to send, encoded as per Encoding.
+	Payload string `json:"payload,omitempty" yaml:"payload,omitempty"`
+	// Encoding is the encoding of the payload: text (the default), hex or base64.
+	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+	// Expect contains the assertions on the response.
+	Expect *UDPExpect `json:"expect,omitempty" yaml:"expect,omitempty"`
+}
+
+// UDPExpect contains the assertions on the response to a UDP probe.
+type UDPExpect struct {
+	// Contains is a string the response must contain.
+	Contains string `json:"contains,omitempty" yaml:"contains,omitempty"`
+	// Matches is a regular expression the response must match.
+	Matches string `json:"matches,omitempty" yaml:"matches,omitempty"`
+}
+
+// UDPResult contains the response received in a UDP check.
+type UDPResult struct {
+	// Response is the datagram received from the server, hex encoded.
+	Response string `json:"response,omitempty" yaml:"response,omitempty"`
+	// Size is the size of the response, in bytes.
+	Size int `json:"size" yaml:"size"`
+}
+
+// udpPreset is a built-in payload for a common UDP service.
+type udpPreset struct {
+	// payload returns the datagram to send.
+	payload func() []byte
+	// verify checks that the response is valid for the request; if nil, the
+	// service is not expected to reply.
+	verify func(request, response []byte) error
+}
+
+// udpPresets are the built-in payloads, by name.
+var udpPresets = map[string]udpPreset{
+	"dns": {
+		payload: func() []byte {
+			m := &dns.Msg{}
+			m.SetQuestion(".", dns.TypeNS)
+			data, _ := m.Pack()
+			return data
+		},
+		verify: func(request, response []byte) error {
+			if len(response) < 12 || !bytes.Equal(response[:2], request[:2]) || response[2]&0x80 == 0 {
+				return withClass(ClassProtocol, errors.New("response is not a DNS reply"))
+			}
+			return nil
+		},
+	},
+	"ntp": {
+		payload: func() []byte {
+			data := make([]byte, 48)
+			data[0] = 0x1b // no leap indicator, version 3, client mode
+			binary.BigEndian.PutUint64(data[40:], uint64(time.Now().UnixNano()))
+			return data
+		},
+		verify: func(request, response []byte) error {
+			if len(response) < 48 || response[0]&0x07 != 4 {
+				return withClass(ClassProtocol, errors.New("response is not an NTP server reply"))
+			}
+			return nil
+		},
+	},
+	"snmp": {
+		payload: func() []byte {
+			// SNMPv2c GetRequest for sysDescr.0 with community "public"
+			return []byte{
+				0x30, 0x29, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+				0xa0, 0x1c, 0x02, 0x04, 0x6e, 0x65, 0x74, 0x63, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+				0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x05, 0x00,
+			}
+		},
+		verify: func(request, response []byte) error {
+			if len(response) < 2 || response[0] != 0x30 || !bytes.Contains(response, []byte{0xa2}) {
+				return withClass(ClassProtocol, errors.New("response is not an SNMP reply"))
+			}
+			return nil
+		},
+	},
+	"syslog": {
+		payload: func() []byte {
+			return []byte("<14>1 - - netcheck - - - connectivity check")
+		},
+	},
+}
+
+// doUDP sends the probe datagram to the check's address and waits for a
+// response within the timeout: an ICMP port unreachable makes the check fail,
+// while no response at all is reported as a warning, as the port may be
+// either open or filtered.
+func (c *Check) doUDP() error {
+	probe := c.UDP
+	if probe == nil {
+		probe = &UDPProbe{}
+	}
+	var (
+		payload []byte
+		preset  *udpPreset
+		err     error
+	)
+	if probe.Preset != "" {
+		p, ok := udpPresets[strings.ToLower(probe.Preset)]
+		if !ok {
+			return fmt.Errorf("unsupported UDP preset: '%s'", probe.Preset)
+		}
+		preset = &p
+		payload = p.payload()
+	} else {
+		payload, err = probe.decode()
+		if err != nil {
+			slog.Error("invalid UDP payload", "address", c.Address, "error", err)
+			return fmt.Errorf("invalid UDP payload for %s: %w", c.Address, err)
+		}
+	}
+
+	conn, err := net.DialTimeout("udp", c.Address, time.Duration(c.Timeout))
+	if err != nil {
+		slog.Error("error dialling", "address", c.Address, "protocol", c.Protocol.String(), "error", err)
+		return fmt.Errorf("error dialling %s on protocol %s: %w", c.Address, c.Protocol.String(), err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(time.Duration(c.Timeout))); err != nil {
+		return fmt.Errorf("error setting deadline on connection to %s: %w", c.Address, err)
+	}
+	if _, err := conn.Write(payload); err != nil {
+		slog.Error("error sending datagram", "address", c.Address, "error", err)
+		return fmt.Errorf("error sending datagram to %s: %w", c.Address, err)
+	}
+
+	buffer := make([]byte, 65535)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			slog.Error("port unreachable", "address", c.Address, "error", err)
+			return fmt.Errorf("port unreachable on host %s: %w", c.Address, err)
+		case errors.As(err, &netErr) && netErr.Timeout():
+			if preset != nil && preset.verify == nil && probe.Expect == nil {
+				// the service is not expected to reply
+				slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String())
+				return nil
+			}
+			if probe.Expect != nil {
+				// there is no response to verify the assertions on
+				slog.Error("no response", "address", c.Address, "protocol", c.Protocol.String())
+				return withClass(ClassTimeout, fmt.Errorf("no response from host %s on protocol %s: %w", c.Address, c.Protocol.String(), err))
+			}
+			slog.Warn("no response", "address", c.Address, "protocol", c.Protocol.String())
+			c.Result.warning = withClass(ClassTimeout, fmt.Errorf("no response from host %s on protocol %s (open|filtered)", c.Address, c.Protocol.String()))
+			return nil
+		default:
+			slog.Error("error receiving datagram", "address", c.Address, "error", err)
+			return fmt.Errorf("error receiving datagram from %s: %w", c.Address, err)
+		}
+	}
+	response := buffer[:n]
+	c.Result.UDP = &UDPResult{
+		Response: hex.EncodeToString(response),
+		Size:     n,
+	}
+
+	if preset != nil && preset.verify != nil {
+		if err := preset.verify(payload, response); err != nil {
+			slog.Error("unexpected response", "address", c.Address, "preset", probe.Preset, "error", err)
+			return fmt.Errorf("unexpected response from host %s: %w", c.Address, err)
+		}
+	}
+	if probe.Expect != nil {
+		if err := probe.Expect.verify(response); err != nil {
+			slog.Error("unexpected response", "address", c.Address, "error", err)
+			return withClass(ClassAssertionFailed, fmt.Errorf("unexpected response from host %s: %w", c.Address, err))
+		}
+	}
+	slog.Info("successfully tested connection", "address", c.Address, "protocol", c.Protocol.String(), "response size", n)
+	return nil
+}
+
+// decode returns the payload as raw bytes.
+func (p *UDPProbe) decode() ([]byte, error) {
+	switch strings.ToLower(p.Encoding) {
+	case "", "text":
+		return []byte(p.Payload), nil
+	case "hex":
+		return hex.DecodeString(strings.NewReplacer(" ", "", ":", "").Replace(p.Payload))
+	case "base64":
+		return base64.StdEncoding.DecodeString(p.Payload)
+	}
+	return nil, fmt.Errorf("unsupported payload encoding: '%s'", p.Encoding)
+}
+
+// verify checks the response against the expectations.
+func (e *UDPExpect) verify(response []byte) error {
+	if e.Contains != "" && !bytes.Contains(response, []byte(e.Contains)) {
+		return fmt.Errorf("response does not contain '%s'", e.Contains)
+	}
+	if e.Matches != "" {
+		re, err := regexp.Compile(e.Matches)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression '%s': %w", e.Matches, err)
+		}
+		if !re.Match(response) {
+			return fmt.Errorf("response does not match '%s'", e.Matches)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package checks
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startUDPServer starts a UDP server that answers each datagram with the
+// response returned by the given handler, or does not answer at all if the
+// response is nil.
+func startUDPServer(handler func(request []byte) []byte) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not start UDP server: %v", err)
+	}
+	go func() {
+		buffer := make([]byte, 65535)
+		for {
+			n, address, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			if response := handler(buffer[:n]); response != nil {
+				_, _ = conn.WriteTo(response, address)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func TestUDP(t *testing.T) {
+	echo, stop := startUDPServer(func(request []byte) []byte {
+		return append([]byte("echo: "), request...)
+	})
+	defer stop()
+	silent, stop := startUDPServer(func([]byte) []byte { return nil })
+	defer stop()
+	ntp, stop := startUDPServer(func(request []byte) []byte {
+		response := make([]byte, 48)
+		response[0] = 0x1c // no leap indicator, version 3, server mode
+		return response
+	})
+	defer stop()
+	resolver, stop := startDNSServer("udp")
+	defer stop()
+
+	// a port nobody listens on
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Could not allocate UDP port: %v", err)
+	}
+	closed := conn.LocalAddr().String()
+	conn.Close()
+
+	tests := []struct {
+		address string
+		probe   *UDPProbe
+		status  Status
+		message string
+	}{
+		{echo, &UDPProbe{Payload: "hello", Expect: &UDPExpect{Contains: "echo: hello"}}, Success, "success"},
+		{echo, &UDPProbe{Payload: "68656c6c6f", Encoding: "hex", Expect: &UDPExpect{Matches: `^echo: h.*o$`}}, Success, "success"},
+		{echo, &UDPProbe{Payload: "aGVsbG8=", Encoding: "base64", Expect: &UDPExpect{Contains: "hello"}}, Success, "success"},
+		{echo, &UDPProbe{Payload: "hello", Expect: &UDPExpect{Contains: "goodbye"}}, Failure, "does not contain 'goodbye'"},
+		{echo, &UDPProbe{Payload: "zz", Encoding: "hex"}, Failure, "invalid UDP payload"},
+		{echo, &UDPProbe{Payload: "hello", Encoding: "rot13"}, Failure, "unsupported payload encoding"},
+		{echo, &UDPProbe{Preset: "ntp"}, Failure, "not an NTP server reply"},
+		{echo, &UDPProbe{Preset: "quake"}, Failure, "unsupported UDP preset"},
+		{echo, nil, Success, "success"},
+		{ntp, &UDPProbe{Preset: "ntp"}, Success, "success"},
+		{resolver, &UDPProbe{Preset: "dns"}, Success, "success"},
+		{silent, &UDPProbe{Payload: "hello"}, Warning, "(open|filtered)"},
+		{silent, &UDPProbe{Preset: "snmp"}, Warning, "(open|filtered)"},
+		{silent, &UDPProbe{Payload: "hello", Expect: &UDPExpect{Contains: "hello"}}, Failure, "no response"},
+		{silent, &UDPProbe{Preset: "syslog"}, Success, "success"},
+		{closed, &UDPProbe{Payload: "hello"}, Failure, "port unreachable"},
+	}
+
+	for i, test := range tests {
+		check := &Check{
+			Address:  test.address,
+			Protocol: UDP,
+			Timeout:  Timeout(500 * time.Millisecond),
+			UDP:      test.probe,
+		}
+		check.Result.err = check.Do()
+		if check.Result.Status() != test.status || !strings.Contains(check.Result.String(), test.message) {
+			log.Fatalf("Unexpected result in test %d: expected %v (%s), got %v (%s)", i, test.status, test.message, check.Result.Status(), check.Result.String())
+		}
+		if test.status == Failure && test.address == silent && check.Result.Class() != ClassTimeout {
+			log.Fatalf("Unexpected class in test %d: %s", i, check.Result.Class())
+		}
+		if test.status == Success && test.address == echo && (check.Result.UDP == nil || check.Result.UDP.Size == 0) {
+			log.Fatalf("Response not recorded in test %d: %+v", i, check.Result.UDP)
+		}
+	}
+
+	// the presets produce well-formed requests
+	for name, preset := range udpPresets {
+		if payload := preset.payload(); len(payload) == 0 || (name == "snmp" && !bytes.HasPrefix(payload, []byte{0x30, byte(len(payload) - 2)})) {
+			log.Fatalf("Malformed payload for preset %s: %x", name, payload)
+		}
+	}
+}
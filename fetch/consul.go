@@ -3,10 +3,13 @@ package fetch
 import (
 	"fmt"
 	"log/slog"
+	"net"
+	"net/http"
 	"net/url"
 
 	"github.com/dihedron/netcheck/format"
 	"github.com/dihedron/netcheck/logging"
+	"github.com/dihedron/netcheck/tlsconfig"
 	capi "github.com/hashicorp/consul/api"
 )
 
@@ -24,7 +27,9 @@ import (
 // or
 //
 //	consulkvs-://:token@redis.example.com:8200?dc=myDC&key=/path/to/my/my_key
-func FromConsulKV(path string) ([]byte, format.Format, error) {
+//
+// The optional TLS settings apply to TLS API calls.
+func FromConsulKV(path string, options *tlsconfig.Options) ([]byte, format.Format, error) {
 	u, err := url.Parse(path)
 	if err != nil {
 		slog.Error("error parsing Consul URL", "url", path, "error", err)
@@ -47,6 +52,11 @@ func FromConsulKV(path string) ([]byte, format.Format, error) {
 			InsecureSkipVerify: true,
 		}
 	}
+	if config.Scheme == "https" && options != nil {
+		if err := setupConsulTLS(config, options); err != nil {
+			return nil, format.Format(-1), err
+		}
+	}
 
 	// retrieve and populate authentication info
 	username := u.User.Username()
@@ -122,7 +132,9 @@ func FromConsulKV(path string) ([]byte, format.Format, error) {
 // or
 //
 //	consulsrs-://:token@redis.example.com:8200?dc=myDC&service=my_service&tag=my_tag&meta=my_key
-func FromConsulSR(path string) ([]byte, format.Format, error) {
+//
+// The optional TLS settings apply to TLS API calls.
+func FromConsulSR(path string, options *tlsconfig.Options) ([]byte, format.Format, error) {
 	u, err := url.Parse(path)
 	if err != nil {
 		slog.Error("error parsing Consul URL", "url", path, "error", err)
@@ -145,6 +157,11 @@ func FromConsulSR(path string) ([]byte, format.Format, error) {
 			InsecureSkipVerify: true,
 		}
 	}
+	if config.Scheme == "https" && options != nil {
+		if err := setupConsulTLS(config, options); err != nil {
+			return nil, format.Format(-1), err
+		}
+	}
 
 	// retrieve and populate authentication info
 	username := u.User.Username()
@@ -225,3 +242,32 @@ func FromConsulSR(path string) ([]byte, format.Format, error) {
 
 	return []byte(data), f, nil
 }
+
+// setupConsulTLS configures the Consul API client to use a dedicated HTTP client
+// with the TLS configuration corresponding to the given options.
+func setupConsulTLS(config *capi.Config, options *tlsconfig.Options) error {
+	tlsConfig, err := tlsconfig.New(options, hostname(config.Address))
+	if err != nil {
+		slog.Error("error preparing TLS configuration", "error", err)
+		return err
+	}
+	if config.TLSConfig.InsecureSkipVerify {
+		slog.Debug("disabling TLS verification...")
+		tlsConfig.InsecureSkipVerify = true // #nosec G402
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	config.HttpClient = &http.Client{
+		Transport: transport,
+	}
+	return nil
+}
+
+// hostname returns the host part of an address in the host:port form.
+func hostname(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
@@ -2,7 +2,6 @@ package fetch
 
 import (
 	"bytes"
-	"crypto/tls"
 	"io"
 	"log/slog"
 	"net/http"
@@ -11,14 +10,16 @@ import (
 
 	"github.com/dihedron/netcheck/format"
 	"github.com/dihedron/netcheck/logging"
+	"github.com/dihedron/netcheck/tlsconfig"
 	"github.com/dpotapov/go-spnego"
 )
 
 // FromHTTP retrieves a bundle from an HTTP URL; the server must set the Content-Type
 // header correctly in order to give the right hint about which parser to use to
 // read and analyse the checks bundle. If the URL has the "https-://" scheme, the
-// certificate verification is skipped.
-func FromHTTP(path string) ([]byte, format.Format, error) {
+// certificate verification is skipped. The optional TLS settings provide custom
+// trust anchors, client certificates and the like for HTTPS connections.
+func FromHTTP(path string, options *tlsconfig.Options) ([]byte, format.Format, error) {
 
 	// handle the case where TLS verification is disabled
 	u, err := url.Parse(path)
@@ -29,38 +30,38 @@ func FromHTTP(path string) ([]byte, format.Format, error) {
 
 	slog.Debug("parsed HTTP URL", "object", logging.ToJSON(u))
 
-	client := http.DefaultClient
+	// never touch http.DefaultClient, which is shared with the rest of the
+	// process, and build a dedicated client instead
+	client := &http.Client{}
 
+	var transport *http.Transport
 	if strings.Contains(u.Scheme, "+sso") {
 		slog.Debug("SSO authentication requested...")
 		// create an NTM-aware transport
-		client.Transport = &spnego.Transport{}
-		client.Transport.(*spnego.Transport).Transport = *http.DefaultTransport.(*http.Transport).Clone()
-		if u.Scheme == "https+sso-" {
-			slog.Debug("disabling TLS verification...")
-			client.Transport.(*spnego.Transport).Transport.TLSClientConfig = &tls.Config{
-				InsecureSkipVerify: true, // #nosec G402
-			}
-		}
-		u.Scheme = strings.ReplaceAll(u.Scheme, "+sso", "")
-		if u.Scheme == "https-" {
-			u.Scheme = "https"
-		}
+		sso := &spnego.Transport{}
+		// ensure that the HTTP_PROXY* variables are honoured
+		sso.Transport = *http.DefaultTransport.(*http.Transport).Clone()
+		transport = &sso.Transport
+		client.Transport = sso
 	} else {
 		slog.Debug("plain HTTP(s) requested...")
-		if u.Scheme == "https-" {
-			slog.Debug("disabling TLS verification...")
-			client.Transport = &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true, // #nosec G402
-				},
-			}
-			u.Scheme = "https"
-		} else {
-			slog.Debug("different scheme", "scheme", u.Scheme)
-		}
+		// ensure that the HTTP_PROXY* variables are honoured
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		client.Transport = transport
 	}
 
+	config, err := tlsconfig.New(options, "")
+	if err != nil {
+		slog.Error("error preparing TLS configuration", "error", err)
+		return nil, format.Format(-1), err
+	}
+	if u.Scheme == "https-" || u.Scheme == "https+sso-" {
+		slog.Debug("disabling TLS verification...")
+		config.InsecureSkipVerify = true // #nosec G402
+	}
+	transport.TLSClientConfig = config
+	u.Scheme = strings.TrimSuffix(strings.ReplaceAll(u.Scheme, "+sso", ""), "-")
+
 	path = u.String()
 	slog.Debug("placing request to HTTP server", "url", path)
 
@@ -2,10 +2,12 @@ package fetch
 
 import (
 	"context"
+	"encoding/pem"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -13,6 +15,7 @@ import (
 	"time"
 
 	"github.com/dihedron/netcheck/format"
+	"github.com/dihedron/netcheck/tlsconfig"
 )
 
 func TestFromHTTP(t *testing.T) {
@@ -62,7 +65,7 @@ func TestFromHTTP(t *testing.T) {
 
 	for path, expected := range tests {
 		slog.Debug("reading bundle from HTTP URL", "path", path)
-		_, actual, err := FromHTTP(fmt.Sprintf("http://localhost:3333/%s", path))
+		_, actual, err := FromHTTP(fmt.Sprintf("http://localhost:3333/%s", path), nil)
 		if err != nil {
 			log.Fatalf("Could not download file %s: %v", path, err)
 		}
@@ -122,7 +125,7 @@ func TestFromHTTPs(t *testing.T) {
 
 	for path := range tests {
 		slog.Debug("reading bundle from HTTP URL", "path", path)
-		_, _, err := FromHTTP(fmt.Sprintf("https://localhost:3334/%s", path))
+		_, _, err := FromHTTP(fmt.Sprintf("https://localhost:3334/%s", path), nil)
 		if err == nil {
 			log.Fatalf("TLS handshake error expected when downloading %s, got none instead", path)
 		}
@@ -181,7 +184,7 @@ func TestFromHTTPsSkipTLS(t *testing.T) {
 
 	for path, expected := range tests {
 		slog.Debug("reading bundle from HTTP URL", "path", path)
-		_, actual, err := FromHTTP(fmt.Sprintf("https-://localhost:3335/%s", path))
+		_, actual, err := FromHTTP(fmt.Sprintf("https-://localhost:3335/%s", path), nil)
 		if err != nil {
 			log.Fatalf("Could not download file %s: %v", path, err)
 		}
@@ -190,3 +193,33 @@ func TestFromHTTPsSkipTLS(t *testing.T) {
 		}
 	}
 }
+
+func TestFromHTTPsCustomCA(t *testing.T) {
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeFile(w, r, "../_test/netcheck.json")
+	}))
+	defer server.Close()
+
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	// without the custom trust anchor the certificate cannot be verified...
+	if _, _, err := FromHTTP(server.URL+"/netcheck.json", nil); err == nil {
+		log.Fatalf("TLS handshake error expected without custom CA, got none instead")
+	}
+
+	// ... whereas with it the bundle is downloaded
+	_, actual, err := FromHTTP(server.URL+"/netcheck.json", &tlsconfig.Options{CA: ca})
+	if err != nil {
+		log.Fatalf("Could not download file with custom CA: %v", err)
+	}
+	if actual != format.JSON {
+		log.Fatalf("Invalid format detected: expected %v, actual %v", format.JSON, actual)
+	}
+
+	// the server certificate is only valid for 127.0.0.1 and example.com
+	if _, _, err := FromHTTP(server.URL+"/netcheck.json", &tlsconfig.Options{CA: ca, ServerName: "www.example.org"}); err == nil {
+		log.Fatalf("TLS handshake error expected with wrong server name, got none instead")
+	}
+}
@@ -2,7 +2,6 @@ package fetch
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -10,6 +9,7 @@ import (
 
 	"github.com/dihedron/netcheck/format"
 	"github.com/dihedron/netcheck/logging"
+	"github.com/dihedron/netcheck/tlsconfig"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -25,7 +25,9 @@ import (
 // or
 //
 //	rediss://redis.example.com:6379?db=3&key=/path/to/my/my_key
-func FromRedis(path string) ([]byte, format.Format, error) {
+//
+// The optional TLS settings apply to secure-Redis connections.
+func FromRedis(path string, options *tlsconfig.Options) ([]byte, format.Format, error) {
 	skiptls := false
 
 	u, err := url.Parse(path)
@@ -59,11 +61,17 @@ func FromRedis(path string) ([]byte, format.Format, error) {
 		return nil, format.Format(-1), err
 	}
 
-	if skiptls {
-		slog.Debug("disabling certificate verification on TLS...")
-		opts.TLSConfig = &tls.Config{
-			InsecureSkipVerify: true, // #nosec G402
+	if opts.TLSConfig != nil {
+		config, err := tlsconfig.New(options, opts.TLSConfig.ServerName)
+		if err != nil {
+			slog.Error("error preparing TLS configuration", "error", err)
+			return nil, format.Format(-1), err
+		}
+		if skiptls {
+			slog.Debug("disabling certificate verification on TLS...")
+			config.InsecureSkipVerify = true // #nosec G402
 		}
+		opts.TLSConfig = config
 	}
 
 	db := int64(0)
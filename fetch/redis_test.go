@@ -66,7 +66,7 @@ func TestFromRedis(t *testing.T) {
 		log.Fatalf("Could not write key file %s: %v", path, err)
 	}
 
-	after, _, err := FromRedis(fmt.Sprintf("redis://localhost:%d?db=%d&key=/path/to/key", port.Int(), db))
+	after, _, err := FromRedis(fmt.Sprintf("redis://localhost:%d?db=%d&key=/path/to/key", port.Int(), db), nil)
 	if err != nil {
 		log.Fatalf("Could not open client: %s", err)
 	}
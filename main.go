@@ -36,9 +36,10 @@ func main() {
 	}
 
 	var options struct {
-		Format      string  `short:"f" long:"format" choice:"json" choice:"yaml" choice:"text" choice:"template" optional:"true" default:"text"`
+		Format      string  `short:"f" long:"format" choice:"json" choice:"yaml" choice:"text" choice:"template" choice:"certificates" optional:"true" default:"text"`
 		Template    *string `short:"t" long:"template" optional:"true"`
 		Diagnostics bool    `long:"print-diagnostics" optional:"true"`
+		Explain     bool    `short:"e" long:"explain" optional:"true"`
 	}
 
 	args, err := flags.Parse(&options)
@@ -71,6 +72,12 @@ func main() {
 		}
 	}
 
+	if options.Format == "certificates" && len(args) == 0 {
+		slog.Error("no bundles specified for certificates inventory")
+		fmt.Fprintf(os.Stderr, "No bundles specified: the certificates inventory requires at least one bundle to check\n")
+		os.Exit(1)
+	}
+
 	var output any
 
 	if len(args) == 0 {
@@ -87,6 +94,12 @@ func main() {
 				fmt.Fprintf(os.Stderr, "Cannot load package from %s: %v\n", arg, err)
 				os.Exit(1)
 			}
+			if options.Explain {
+				// diagnose all failed checks
+				for i := range bundle.Checks {
+					bundle.Checks[i].Explain = true
+				}
+			}
 
 			if options.Format == "text" {
 				if isatty.IsTerminal(os.Stdout.Fd()) {
@@ -133,6 +146,10 @@ func main() {
 		printAsJSON(output)
 	case "yaml":
 		printAsYAML(output)
+	case "certificates":
+		if bundles, ok := output.([]*checks.Bundle); ok {
+			printCertificates(bundles)
+		}
 	case "template":
 		printAsTemplate(output, *options.Template)
 		if len(args) == 0 && options.Diagnostics {
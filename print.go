@@ -8,11 +8,13 @@ import (
 	"path"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/dihedron/netcheck/checks"
 	"github.com/dihedron/netcheck/extensions"
 	"github.com/dihedron/netcheck/logging"
+	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/mattn/go-isatty"
 	"gopkg.in/yaml.v3"
 )
@@ -32,45 +34,49 @@ func printAsText(bundle *checks.Bundle, source string) {
 					port = "443"
 				case checks.SSH:
 					port = "22"
+				case checks.DNS:
+					port = "53"
 				default:
 					port = "-"
 				}
 			}
-			if check.Result.IsError() {
+			switch check.Result.Status() {
+			case checks.Failure:
 				fmt.Printf(
 					"%s %5s %-5s → %-32s : %-32s %v\n",
 					red("▼"),
-					strings.Repeat(" ", 5-len(port))+cyan(port),
-					magenta(check.Protocol.String())+strings.Repeat(" ", 5-len(check.Protocol.String())),
+					strings.Repeat(" ", max(0, 5-len(port)))+cyan(port),
+					magenta(check.Protocol.String())+strings.Repeat(" ", max(0, 5-len(check.Protocol.String()))),
 					target,
-					func() string {
-						if s := strings.TrimSpace(check.Name); s != "" {
-							if len(s) > NameLength {
-								return s[:NameLength-3] + "..."
-							}
-							return s
-						}
-						return ""
-					}(),
+					shortName(check),
 					blue("("+check.Result.String()+")")) // was ✖
-			} else {
+			case checks.Warning:
+				fmt.Printf(
+					"%s %5s %-5s → %-32s : %-32s %v\n",
+					yellow("◆"),
+					strings.Repeat(" ", max(0, 5-len(port)))+cyan(port),
+					magenta(check.Protocol.String())+strings.Repeat(" ", max(0, 5-len(check.Protocol.String()))),
+					target,
+					shortName(check),
+					yellow("("+check.Result.String()+")"+flakyMarker(check)))
+			default:
+				marker := flakyMarker(check)
+				if marker != "" {
+					marker = yellow(marker)
+				}
 				fmt.Printf(
-					"%s %5s %-5s → %-32s : %-32s\n",
+					"%s %5s %-5s → %-32s : %-32s%s\n",
 					green("▲"),
-					strings.Repeat(" ", 5-len(port))+cyan(port),
-					magenta(check.Protocol.String())+strings.Repeat(" ", 5-len(check.Protocol.String())),
+					strings.Repeat(" ", max(0, 5-len(port)))+cyan(port),
+					magenta(check.Protocol.String())+strings.Repeat(" ", max(0, 5-len(check.Protocol.String()))),
 					target,
-					func() string {
-						if s := strings.TrimSpace(check.Name); s != "" {
-							if len(s) > NameLength {
-								return s[:NameLength-3] + "..."
-							}
-							return s
-						}
-						return ""
-					}(),
+					shortName(check),
+					marker,
 				) // was ✔
 			}
+			printHistory(check, true)
+			printExplanation(check, true)
+			printTrace(check, true)
 		}
 	} else {
 		//fmt.Printf("%s %s\n", "►", bundle.ID)
@@ -79,7 +85,8 @@ func printAsText(bundle *checks.Bundle, source string) {
 			if port == "" {
 				port = "-"
 			}
-			if check.Result.IsError() {
+			switch check.Result.Status() {
+			case checks.Failure:
 				fmt.Printf(
 					// "%s %5s %-4s - %32s : %s → %s (%v)\n",
 					"%s %5s %-5s → %-32s : %-32s %v\n",
@@ -87,40 +94,109 @@ func printAsText(bundle *checks.Bundle, source string) {
 					port,
 					check.Protocol.String(),
 					target,
-					func() string {
-						if s := strings.TrimSpace(check.Name); s != "" {
-							if len(s) > NameLength {
-								return s[:NameLength-3] + "..."
-							}
-							return s
-						}
-						return ""
-					}(),
+					shortName(check),
 					check.Result.String(),
 				) // was ✖
-			} else {
+			case checks.Warning:
+				fmt.Printf(
+					"%s %5s %-5s → %-32s : %-32s %v%s\n",
+					"◆",
+					port,
+					check.Protocol.String(),
+					target,
+					shortName(check),
+					check.Result.String(),
+					flakyMarker(check),
+				)
+			default:
 				fmt.Printf(
 					//"%s %5s %-4s - %32s : %s → %s\n",
-					"%s %5s %-5s → %-32s : %-32s\n",
+					"%s %5s %-5s → %-32s : %-32s%s\n",
 					"▲",
 					port,
 					check.Protocol.String(),
 					target,
-					func() string {
-						if s := strings.TrimSpace(check.Name); s != "" {
-							if len(s) > NameLength {
-								return s[:NameLength-3] + "..."
-							}
-							return s
-						}
-						return ""
-					}(),
+					shortName(check),
+					flakyMarker(check),
 				) // was ✔
 			}
+			printHistory(check, false)
+			printExplanation(check, false)
+			printTrace(check, false)
 		}
 	}
 }
 
+// flakyMarker returns the marker appended to the line of a check that
+// succeeded only after failed attempts, or an empty string.
+func flakyMarker(check checks.Check) string {
+	if !check.Result.IsFlaky() {
+		return ""
+	}
+	return fmt.Sprintf(" [flaky: %d attempts]", len(check.Result.History))
+}
+
+// printHistory prints the attempts of the flaky check, if so, under the
+// check's line.
+func printHistory(check checks.Check, colour bool) {
+	if !check.Result.IsFlaky() {
+		return
+	}
+	for i, attempt := range check.Result.History {
+		line := fmt.Sprintf("#%-3d %s", i+1, attempt)
+		if colour && attempt.Status == checks.Failure {
+			line = yellow(line)
+		}
+		fmt.Printf("        %s\n", line)
+	}
+}
+
+// printExplanation prints the diagnosis of the failed check, if any, under
+// the check's line.
+func printExplanation(check checks.Check, colour bool) {
+	if check.Result.Explanation == nil {
+		return
+	}
+	for _, step := range check.Result.Explanation.Steps {
+		line := step.String()
+		if colour {
+			switch {
+			case step.Layer == check.Result.Explanation.Layer:
+				line = red(line)
+			case !step.OK:
+				line = yellow(line)
+			}
+		}
+		fmt.Printf("        %s\n", line)
+	}
+}
+
+// printTrace prints the hops of the route traced to the check's host, if any,
+// under the check's line.
+func printTrace(check checks.Check, colour bool) {
+	if check.Result.Trace == nil {
+		return
+	}
+	for _, hop := range check.Result.Trace.Hops {
+		line := hop.String()
+		if colour && hop.Address == "" {
+			line = yellow(line)
+		}
+		fmt.Printf("        %s\n", line)
+	}
+}
+
+// shortName returns the name of the check, truncated to NameLength.
+func shortName(check checks.Check) string {
+	if s := strings.TrimSpace(check.Name); s != "" {
+		if len(s) > NameLength {
+			return s[:NameLength-3] + "..."
+		}
+		return s
+	}
+	return ""
+}
+
 func printAsJSON(bundles any) {
 	data, err := json.MarshalIndent(bundles, "", "  ")
 	if err != nil {
@@ -141,6 +217,50 @@ func printAsYAML(bundles any) {
 	fmt.Printf("%s\n", string(data))
 }
 
+func printCertificates(bundles []*checks.Bundle) {
+	colour := isatty.IsTerminal(os.Stdout.Fd())
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Not Before", "Not After", "Days", "Subject", "SANs", "Issuer", "Serial", "Key", "Signature", "SHA-256", "Endpoints"})
+	for _, item := range checks.Inventory(bundles...) {
+		days := int(time.Until(item.NotAfter).Hours() / 24)
+		left := fmt.Sprintf("%d", days)
+		if colour {
+			switch {
+			case days < 0:
+				left = red(left)
+			case days < 30:
+				left = yellow(left)
+			default:
+				left = green(left)
+			}
+		}
+		endpoints := []string{}
+		for _, session := range item.Sessions {
+			negotiated := []string{session.Version, session.CipherSuite}
+			if session.ALPN != "" {
+				negotiated = append(negotiated, session.ALPN)
+			}
+			endpoints = append(endpoints, fmt.Sprintf("%s (%s)", session.Endpoint, strings.Join(negotiated, ", ")))
+		}
+		t.AppendRow(table.Row{
+			item.NotBefore.Format(time.DateOnly),
+			item.NotAfter.Format(time.DateOnly),
+			left,
+			item.Subject,
+			strings.Join(item.SANs, "\n"),
+			item.Issuer,
+			item.Serial,
+			fmt.Sprintf("%s %d", item.KeyType, item.KeySize),
+			item.SignatureAlgorithm,
+			item.Fingerprint,
+			strings.Join(endpoints, "\n"),
+		})
+	}
+	t.SetStyle(table.StyleLight)
+	t.Render()
+}
+
 func printAsTemplate(bundles any, templ string) {
 	slog.Debug("using template file", "path", templ)
 	functions := template.FuncMap{}
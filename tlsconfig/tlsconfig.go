@@ -0,0 +1,141 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Options contains the TLS settings shared by checks and bundle fetchers; the
+// CA bundle, the client certificate and its key can be provided either as the
+// path to a PEM file or inline, as the PEM data itself.
+type Options struct {
+	// CA is the bundle of trust anchors used to verify the server certificate,
+	// in addition to the system ones.
+	CA string `json:"ca,omitempty" yaml:"ca,omitempty"`
+	// Cert is the client certificate, for mutual TLS authentication.
+	Cert string `json:"cert,omitempty" yaml:"cert,omitempty"`
+	// Key is the private key of the client certificate.
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+	// ServerName overrides the name sent in the SNI extension and verified
+	// against the server certificate.
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+	// MinVersion is the minimum accepted TLS version (e.g. "1.2").
+	MinVersion string `json:"min_version,omitempty" yaml:"min_version,omitempty"`
+	// MaxVersion is the maximum accepted TLS version (e.g. "1.3").
+	MaxVersion string `json:"max_version,omitempty" yaml:"max_version,omitempty"`
+	// Insecure disables the verification of the server certificate.
+	Insecure bool `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+}
+
+// New returns the TLS configuration corresponding to the given options, which
+// can be nil; the server name is used for SNI and certificate verification
+// unless overridden in the options.
+func New(options *Options, serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if options == nil {
+		return config, nil
+	}
+
+	if options.ServerName != "" {
+		config.ServerName = options.ServerName
+	}
+	if options.Insecure {
+		slog.Debug("disabling TLS verification...")
+		config.InsecureSkipVerify = true // #nosec G402
+	}
+
+	if options.MinVersion != "" {
+		version, err := ParseVersion(options.MinVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_version: %w", err)
+		}
+		config.MinVersion = version
+	}
+	if options.MaxVersion != "" {
+		version, err := ParseVersion(options.MaxVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_version: %w", err)
+		}
+		config.MaxVersion = version
+	}
+	if config.MaxVersion != 0 && config.MaxVersion < config.MinVersion {
+		// the minimum version may be the default one, not in the options
+		return nil, fmt.Errorf("max_version '%s' (%s) is lower than min_version (%s)", options.MaxVersion, tls.VersionName(config.MaxVersion), tls.VersionName(config.MinVersion))
+	}
+
+	if options.CA != "" {
+		data, err := load(options.CA)
+		if err != nil {
+			slog.Error("error loading CA bundle", "error", err)
+			return nil, fmt.Errorf("error loading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			slog.Warn("system certificate pool not available", "error", err)
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			slog.Error("no valid certificates in CA bundle")
+			return nil, errors.New("no valid certificates in CA bundle")
+		}
+		config.RootCAs = pool
+	}
+
+	if options.Cert != "" || options.Key != "" {
+		if options.Cert == "" || options.Key == "" {
+			return nil, errors.New("both client certificate and key must be provided")
+		}
+		cert, err := load(options.Cert)
+		if err != nil {
+			slog.Error("error loading client certificate", "error", err)
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		key, err := load(options.Key)
+		if err != nil {
+			slog.Error("error loading client key", "error", err)
+			return nil, fmt.Errorf("error loading client key: %w", err)
+		}
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			slog.Error("error parsing client certificate and key", "error", err)
+			return nil, fmt.Errorf("error parsing client certificate and key: %w", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return config, nil
+}
+
+// ParseVersion returns the TLS version corresponding to the given string,
+// e.g. "1.2" or "TLS1.2".
+func ParseVersion(value string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version: '%s'", value)
+}
+
+// load returns the PEM data in the value, either inline or read from the file
+// at the path it contains.
+func load(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(filepath.Clean(value))
+}